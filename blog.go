@@ -3,27 +3,35 @@ package blog
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	"github.com/kirsle/blog/jsondb"
 	"github.com/kirsle/blog/jsondb/caches"
+	"github.com/kirsle/blog/jsondb/caches/memory"
+	"github.com/kirsle/blog/jsondb/caches/metrics"
 	"github.com/kirsle/blog/jsondb/caches/null"
 	"github.com/kirsle/blog/jsondb/caches/redis"
 	"github.com/kirsle/blog/models/comments"
 	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
 	"github.com/kirsle/blog/models/settings"
 	"github.com/kirsle/blog/models/users"
+	"github.com/kirsle/blog/src/backup"
 	"github.com/kirsle/blog/src/controllers/admin"
 	"github.com/kirsle/blog/src/controllers/authctl"
 	commentctl "github.com/kirsle/blog/src/controllers/comments"
 	"github.com/kirsle/blog/src/controllers/contact"
 	postctl "github.com/kirsle/blog/src/controllers/posts"
 	questionsctl "github.com/kirsle/blog/src/controllers/questions"
+	searchctl "github.com/kirsle/blog/src/controllers/search"
 	"github.com/kirsle/blog/src/controllers/setup"
+	"github.com/kirsle/blog/src/export"
 	"github.com/kirsle/blog/src/log"
 	"github.com/kirsle/blog/src/markdown"
 	"github.com/kirsle/blog/src/middleware"
@@ -32,6 +40,7 @@ import (
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/src/responses"
 	"github.com/kirsle/blog/src/sessions"
+	"github.com/kirsle/blog/src/spam"
 	"github.com/shurcooL/github_flavored_markdown/gfmstyle"
 	"github.com/urfave/negroni"
 )
@@ -45,9 +54,11 @@ type Blog struct {
 	DocumentRoot string
 	UserRoot     string
 
-	db     *gorm.DB
-	jsonDB *jsondb.DB
-	Cache  caches.Cacher
+	db          *gorm.DB
+	jsonDB      *jsondb.DB
+	Cache       caches.Cacher
+	cacheConfig string   // the cache settings that Cache was set up with
+	serverLock  *os.File // held while serving; see claimUserRoot
 
 	// Web app objects.
 	n *negroni.Negroni // Negroni middleware manager
@@ -69,18 +80,74 @@ func New(documentRoot, userRoot string) *Blog {
 		DocumentRoot: documentRoot,
 		UserRoot:     userRoot,
 		db:           db,
-		jsonDB:       jsondb.New(filepath.Join(userRoot, ".private")),
+		jsonDB:       jsondb.Open(filepath.Join(userRoot, ".private")),
 		Cache:        null.New(),
 	}
 }
 
 // Run quickly configures and starts the HTTP server.
 func (b *Blog) Run(address string) {
+	err := b.claimUserRoot()
+	if err != nil {
+		log.Warn("Can't lock the user root; is another server running on it? %s", err)
+	}
+	if err != errLocked {
+		b.Recover()
+	}
 	b.Configure()
+	posts.StartScheduler(time.Minute)
+	go func() {
+		if _, err := b.jsonDB.RemoveRetired(); err != nil {
+			log.Error("Error removing retired documents: %s", err)
+		}
+		if err := searchctl.Reindex(); err != nil {
+			log.Error("Error updating the search index: %s", err)
+		}
+	}()
 	b.SetupHTTP()
 	b.ListenAndServe(address)
 }
 
+// Recover finishes any JsonDB transactions that were interrupted the last time
+// the site was open. New doesn't, since the journals of a server running on the
+// user root are for transactions it's still making; only the process that has
+// the user root to itself should call this.
+func (b *Blog) Recover() {
+	b.jsonDB.Recover()
+}
+
+// Migrate upgrades every JsonDB document with pending schema migrations and
+// writes it back to disk, returning the number of documents upgraded.
+func (b *Blog) Migrate() (int, error) {
+	return b.jsonDB.Migrate()
+}
+
+// Backup writes a full backup of the user root to `w`. Files named in `skip`
+// are left out of it.
+func (b *Blog) Backup(w io.Writer, skip ...string) error {
+	return backup.Create(w, b.UserRoot, b.db, b.jsonDB, skip...)
+}
+
+// Export renders the public parts of the site into static files in `output`,
+// returning the number of pages written.
+func (b *Blog) Export(output string) (int, error) {
+	b.Configure()
+	b.SetupHTTP()
+	return export.Site(b.n, output, b.isDynamic)
+}
+
+// isDynamic returns whether a URL is served by a controller rather than the
+// catch-all page handler.
+func (b *Blog) isDynamic(path string) bool {
+	var match mux.RouteMatch
+	r, err := http.NewRequest("GET", path, nil)
+	if err != nil || !b.r.Match(r, &match) || match.Route == nil {
+		return false
+	}
+	tpl, _ := match.Route.GetPathTemplate()
+	return tpl != "/"
+}
+
 // Configure initializes (or reloads) the blog's configuration, and binds the
 // settings in sub-packages.
 func (b *Blog) Configure() {
@@ -106,27 +173,84 @@ func (b *Blog) Configure() {
 	posts.DB = b.jsonDB
 	users.DB = b.jsonDB
 	comments.DB = b.jsonDB
+	search.DB = b.jsonDB
+	spam.DB = b.jsonDB
 	models.UseDB(b.db)
+	admin.Backup = func(w io.Writer) error {
+		return b.Backup(w)
+	}
 
-	// Redis cache?
+	// Redis or in-memory cache? The cache is only replaced when its settings
+	// change, so that reloading the settings doesn't throw it away.
+	var cacheConfig string
+	if config.Redis.Enabled {
+		cacheConfig = fmt.Sprintf("redis %s:%d/%d %s",
+			config.Redis.Host, config.Redis.Port, config.Redis.DB, config.Redis.Prefix,
+		)
+	} else if config.Cache.Memory {
+		cacheConfig = fmt.Sprintf("memory %d", config.Cache.MaxKeys)
+	}
+	if cacheConfig != b.cacheConfig {
+		if err := b.configureCache(config); err != nil {
+			// Try again on the next reload.
+			log.Error("Cache init error: %s", err.Error())
+			cacheConfig = ""
+		}
+		b.cacheConfig = cacheConfig
+	}
+
+	// Watch the JsonDB files to keep the cache fresh?
+	if config.Cache.WatchFiles {
+		if err := b.jsonDB.Watch(); err != nil {
+			log.Error("JsonDB file watcher error: %s", err.Error())
+		}
+	} else {
+		b.jsonDB.Unwatch()
+	}
+
+	b.registerErrors()
+}
+
+// configureCache sets up the Redis or in-memory cache from the settings, or
+// goes back to no cache at all if neither is enabled or Redis can't be
+// reached.
+func (b *Blog) configureCache(config *settings.Settings) error {
+	var (
+		cache caches.Cacher
+		err   error
+	)
 	if config.Redis.Enabled {
 		addr := fmt.Sprintf("%s:%d", config.Redis.Host, config.Redis.Port)
 		log.Info("Connecting to Redis at %s/%d", addr, config.Redis.DB)
-		cache, err := redis.New(
+		var redisCache *redis.Redis
+		redisCache, err = redis.New(
 			addr,
 			config.Redis.DB,
 			config.Redis.Prefix,
 		)
-		if err != nil {
-			log.Error("Redis init error: %s", err.Error())
-		} else {
-			b.Cache = cache
-			b.jsonDB.Cache = cache
-			markdown.Cache = cache
+		if err == nil {
+			cache = redisCache
 		}
+	} else if config.Cache.Memory {
+		log.Info("Using the in-memory cache (max %d keys)", config.Cache.MaxKeys)
+		cache = memory.New(config.Cache.MaxKeys)
 	}
 
-	b.registerErrors()
+	if cache == nil {
+		b.Cache = null.New()
+		b.jsonDB.Cache = nil
+		markdown.Cache = nil
+		admin.Cache = nil
+		return err
+	}
+
+	// Count the cache's hits and misses for the admin panel.
+	instrumented := metrics.New(cache)
+	admin.Cache = instrumented
+	b.Cache = instrumented
+	b.jsonDB.Cache = instrumented
+	markdown.Cache = instrumented
+	return nil
 }
 
 // SetupHTTP initializes the Negroni middleware engine and registers routes.
@@ -140,6 +264,7 @@ func (b *Blog) SetupHTTP() {
 	postctl.Register(r, b.MustLogin)
 	commentctl.Register(r)
 	questionsctl.Register(r, b.MustLogin)
+	searchctl.Register(r)
 
 	// GitHub Flavored Markdown CSS.
 	r.Handle("/css/gfm.css", http.StripPrefix("/css", http.FileServer(gfmstyle.Assets)))
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kirsle/blog"
+	"github.com/kirsle/blog/src/backup"
+)
+
+// backupUsage explains the backup command, and why it shouldn't be run on a
+// site that's being served.
+const backupUsage = `Usage: blog backup <user root> [-o site.tar.gz] [-force]
+
+Backs up the database, uploaded files and custom pages of a site that isn't
+running. While the blog server is running on the user root, download a backup
+from its /admin/backup page instead: this command can't keep the server from
+writing while it works, so its copy of the site could be caught half-way
+through a change. Use -force to take one anyway.
+`
+
+// backupCommand runs `blog backup <userRoot> -o site.tar.gz`.
+func backupCommand(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := fs.String("o", "", "Output file (default: <user root>-<date>.tar.gz)")
+	force := fs.Bool("force", false, "Back up even though a server is running on the user root")
+	userRoot := parseCommand(fs, args)
+	if userRoot == "" {
+		fmt.Print(backupUsage)
+		return 1
+	}
+
+	if blog.ServerRunning(userRoot) {
+		if !*force {
+			fmt.Printf("A blog server is running on %s. Download a backup from its\n"+
+				"/admin/backup page instead, or use -force to back it up anyway.\n", userRoot)
+			return 1
+		}
+		fmt.Printf("Warning: a blog server is running on %s, and this backup may\n"+
+			"catch it part way through a change.\n", userRoot)
+	}
+
+	if *output == "" {
+		name, _ := filepath.Abs(userRoot)
+		*output = fmt.Sprintf("%s-%s.tar.gz", filepath.Base(name), time.Now().Format("20060102-150405"))
+	}
+
+	fh, err := os.Create(*output)
+	if err != nil {
+		fmt.Printf("Can't create %s: %s\n", *output, err)
+		return 1
+	}
+
+	app := blog.New(DocumentRoot, userRoot)
+	err = app.Backup(fh, *output)
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		fmt.Printf("Backup failed: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("Backed up %s to %s\n", userRoot, *output)
+	return 0
+}
+
+// restoreCommand runs `blog restore <userRoot> -i site.tar.gz`.
+func restoreCommand(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	input := fs.String("i", "", "Backup file to restore from")
+	userRoot := parseCommand(fs, args)
+	if userRoot == "" || *input == "" {
+		fmt.Printf("Usage: blog restore <user root> -i site.tar.gz\n")
+		return 1
+	}
+
+	// The restore moves the user root aside, and a running server would go on
+	// writing to whichever copy of the site its paths lead to.
+	if blog.ServerRunning(userRoot) {
+		fmt.Printf("A blog server is running on %s. Stop it before restoring.\n", userRoot)
+		return 1
+	}
+
+	fh, err := os.Open(*input)
+	if err != nil {
+		fmt.Printf("Can't open %s: %s\n", *input, err)
+		return 1
+	}
+	defer fh.Close()
+
+	previous, err := backup.Restore(fh, userRoot)
+	if err != nil {
+		fmt.Printf("Restore failed; nothing was changed: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("Restored %s from %s\n", userRoot, *input)
+	if previous != "" {
+		fmt.Printf("The old copy of the site was moved to %s\n", previous)
+	}
+	return 0
+}
+
+// parseCommand parses a subcommand's flags, which may come before or after its
+// <userRoot> argument, and returns the user root.
+func parseCommand(fs *flag.FlagSet, args []string) string {
+	fs.Parse(args)
+	userRoot := fs.Arg(0)
+	if fs.NArg() > 1 {
+		fs.Parse(fs.Args()[1:])
+	}
+	return userRoot
+}
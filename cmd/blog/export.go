@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/kirsle/blog"
+)
+
+// exportCommand runs `blog export-static <userRoot> -o dir/`.
+func exportCommand(args []string) int {
+	fs := flag.NewFlagSet("export-static", flag.ExitOnError)
+	output := fs.String("o", "", "Output folder for the static site")
+	userRoot := parseCommand(fs, args)
+	if userRoot == "" || *output == "" {
+		fmt.Printf("Usage: blog export-static <user root> -o dir/\n")
+		return 1
+	}
+
+	// Exporting builds any missing indexes and settings as it reads them, and
+	// those writes would race with a running server's.
+	if blog.ServerRunning(userRoot) {
+		fmt.Printf("A blog server is running on %s. Stop it before exporting.\n", userRoot)
+		return 1
+	}
+
+	app := blog.New(DocumentRoot, userRoot)
+	app.Recover()
+	count, err := app.Export(*output)
+	if err != nil {
+		fmt.Printf("Export failed: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("Exported %d pages of %s to %s\n", count, userRoot, *output)
+	return 0
+}
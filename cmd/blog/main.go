@@ -46,6 +46,18 @@ func main() {
 		return
 	}
 
+	// Subcommands.
+	switch flag.Arg(0) {
+	case "migrate":
+		os.Exit(migrateCommand(flag.Args()[1:]))
+	case "backup":
+		os.Exit(backupCommand(flag.Args()[1:]))
+	case "restore":
+		os.Exit(restoreCommand(flag.Args()[1:]))
+	case "export-static":
+		os.Exit(exportCommand(flag.Args()[1:]))
+	}
+
 	userRoot := flag.Arg(0)
 	if userRoot == "" {
 		fmt.Printf("Need user root\n")
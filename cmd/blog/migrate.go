@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/kirsle/blog"
+)
+
+// migrateCommand runs the `blog migrate <userRoot>` command, which upgrades all the
+// JsonDB documents to their latest schema versions ahead of time instead of
+// as they're loaded, and deletes the ones that are no longer used.
+func migrateCommand(args []string) int {
+	if len(args) == 0 || args[0] == "" {
+		fmt.Printf("Usage: blog migrate <user root>\n")
+		return 1
+	}
+
+	// A running server's writes would race with the migration, and its
+	// transactions in progress mustn't be recovered out from under it.
+	if blog.ServerRunning(args[0]) {
+		fmt.Printf("A blog server is running on %s. Stop it before migrating;\n"+
+			"it migrates documents as it loads them anyway.\n", args[0])
+		return 1
+	}
+
+	app := blog.New(DocumentRoot, args[0])
+	app.Recover()
+	count, err := app.Migrate()
+	if err != nil {
+		fmt.Printf("Migration failed after %d documents: %s\n", count, err)
+		return 1
+	}
+
+	fmt.Printf("Migrated or removed %d documents.\n", count)
+	return 0
+}
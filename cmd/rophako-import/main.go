@@ -19,6 +19,7 @@ import (
 	"github.com/kirsle/blog/jsondb"
 	"github.com/kirsle/blog/models/comments"
 	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
 	"github.com/kirsle/golog"
 )
 
@@ -83,6 +84,7 @@ func migrateBlog() {
 	log.Warn("Migrating blog entries...")
 	log.Info("Note: all entries will be owned by the admin user (UID 1)")
 	posts.DB = outDB
+	search.DB = outDB
 
 	entries, err := inDB.List("blog/entries")
 	if err != nil {
@@ -0,0 +1,98 @@
+// wxr-import: import blog posts and comments from a WordPress export file
+// (WXR) into the Go blog.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
+	"github.com/kirsle/blog/src/importer"
+	"github.com/kirsle/golog"
+)
+
+var (
+	inPath     string
+	outPath    string
+	photosPath string
+
+	log *golog.Logger
+)
+
+func init() {
+	flag.StringVar(&inPath, "in", "", "Input path: your WordPress export XML file")
+	flag.StringVar(&outPath, "out", "", "Output path: your Blog web root")
+	flag.StringVar(&photosPath, "photos", "", "Optional: a copy of your wp-content/uploads folder, to copy images from")
+
+	log = golog.GetLogger("wxr-import")
+	log.Configure(&golog.Config{
+		Theme:  golog.DarkTheme,
+		Colors: golog.ExtendedColor,
+		Level:  golog.DebugLevel,
+	})
+}
+
+func main() {
+	flag.Parse()
+	if inPath == "" || outPath == "" {
+		log.Error("Usage: wxr-import -in wordpress.xml -out /path/to/blog/root [-photos /path/to/wp-content/uploads]")
+		os.Exit(1)
+	} else if strings.Contains(outPath, "/.private") {
+		log.Error("Do not provide the /.private suffix to -out, only the parent web root")
+		os.Exit(1)
+	}
+
+	fh, err := os.Open(inPath)
+	if err != nil {
+		log.Error("Can't open %s: %s", inPath, err)
+		os.Exit(1)
+	}
+	entries, err := importer.ReadWXR(fh)
+	fh.Close()
+	if err != nil {
+		log.Error("Can't read %s: %s", inPath, err)
+		os.Exit(1)
+	}
+
+	outDB := jsondb.New(strings.TrimSuffix(filepath.Join(outPath, ".private"), "/"))
+	fmt.Printf(
+		"Importing %d WordPress posts from: %s\n"+
+			"Writing output JsonDB to: %s\n"+
+			"OK to continue? [yN] ",
+		len(entries),
+		inPath,
+		outDB.Root,
+	)
+
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+	if !strings.HasPrefix(strings.ToLower(answer), "y") {
+		fmt.Println("Exiting")
+		os.Exit(1)
+	}
+
+	log.Info("Note: all entries will be owned by the admin user (UID 1)")
+	posts.DB = outDB
+	comments.DB = outDB
+	search.DB = outDB
+
+	var photos *importer.Photos
+	if photosPath != "" {
+		photos = importer.NewPhotos(outPath, photosPath)
+	}
+
+	count := importer.Import(entries, photos)
+	log.Info("Imported %d of %d posts", count, len(entries))
+	if photos != nil {
+		for _, link := range photos.Missing {
+			log.Warn("Image not found under %s: %s", photosPath, link)
+		}
+	}
+}
@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/disintegration/imaging v1.6.0 // indirect
 	github.com/edwvee/exiffix v0.0.0-20180602190213-b57537c92a6b
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/garyburd/redigo v1.6.0
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/feeds v1.1.1
@@ -10,6 +10,9 @@ import (
 
 var errCacheDisabled = errors.New("cache disabled")
 
+// CacheLockPrefix starts the cache keys that LockCache uses as locks.
+const CacheLockPrefix = "lock:"
+
 // SetCache sets a cache key.
 func (db *DB) SetCache(key, value string, expires int) error {
 	if db.Cache == nil {
@@ -54,7 +57,7 @@ func (db *DB) LockCache(key string) bool {
 		return true
 	}
 
-	log.Info("LockCache(%s)", key)
+	log.Debug("LockCache(%s)", key)
 
 	var (
 		// In seconds
@@ -63,12 +66,11 @@ func (db *DB) LockCache(key string) bool {
 	)
 
 	identifier := fmt.Sprintf("%d", rand.Uint64())
-	log.Info("id: %s", identifier)
 
 	end := time.Now().Add(timeout)
 	for time.Now().Before(end) {
-		if ok := db.Cache.Lock("lock:"+key, identifier, expire); ok {
-			log.Info("JsonDB: Acquired lock for %s", key)
+		if ok := db.Cache.Lock(CacheLockPrefix+key, identifier, expire); ok {
+			log.Debug("JsonDB: Acquired lock for %s", key)
 			return true
 		}
 		time.Sleep(1 * time.Millisecond)
@@ -82,5 +84,5 @@ func (db *DB) UnlockCache(key string) {
 	if db.Cache == nil {
 		return
 	}
-	db.Cache.Unlock("lock:" + key)
+	db.Cache.Unlock(CacheLockPrefix + key)
 }
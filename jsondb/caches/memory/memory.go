@@ -0,0 +1,264 @@
+// Package memory implements an in-process cache backend with LRU eviction.
+package memory
+
+import (
+	"container/list"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxKeys is the size limit used when New is given zero.
+const DefaultMaxKeys = 10000
+
+// ErrNotFound is returned by Get for missing or expired keys.
+var ErrNotFound = errors.New("key not found")
+
+// Memory is a cache backend that keeps everything in the app's own memory,
+// for single-server sites that don't run Redis.
+//
+// Keys expire after the time given to Set, and when the cache is full the
+// least recently used key is evicted to make room. Locks are kept apart from
+// the cached data so that they're never evicted.
+type Memory struct {
+	maxKeys int
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List // front is the most recently used
+	locks map[string]*item
+}
+
+// item is an entry in the cache.
+type item struct {
+	key     string
+	value   []byte
+	expires time.Time // zero means never
+}
+
+// New Memory backend holding at most `maxKeys` keys.
+func New(maxKeys int) *Memory {
+	if maxKeys <= 0 {
+		maxKeys = DefaultMaxKeys
+	}
+	return &Memory{
+		maxKeys: maxKeys,
+		items:   map[string]*list.Element{},
+		lru:     list.New(),
+		locks:   map[string]*item{},
+	}
+}
+
+// Get a key from Memory.
+func (m *Memory) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.lookup(key)
+	if !ok {
+		if it, ok := m.lookupLock(key); ok {
+			return it.value, nil
+		}
+		return nil, ErrNotFound
+	}
+
+	m.lru.MoveToFront(e)
+	return e.Value.(*item).value, nil
+}
+
+// Set a key in Memory. The key expires after `expires` seconds, or never if
+// it's zero.
+func (m *Memory) Set(key string, v []byte, expires int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, v, expires)
+	return nil
+}
+
+// Delete keys from Memory.
+func (m *Memory) Delete(key ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range key {
+		if e, ok := m.items[k]; ok {
+			m.remove(e)
+		}
+		delete(m.locks, k)
+	}
+}
+
+// Keys returns a list of Memory keys matching a pattern. The pattern uses the
+// same glob syntax as Redis: `*` and `?` wildcards and `[...]` classes.
+func (m *Memory) Keys(pattern string) ([]string, error) {
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []string{}
+	for key := range m.items {
+		if _, ok := m.lookup(key); ok && re.MatchString(key) {
+			result = append(result, key)
+		}
+	}
+	for key := range m.locks {
+		if _, ok := m.lookupLock(key); ok && re.MatchString(key) {
+			result = append(result, key)
+		}
+	}
+	return result, nil
+}
+
+// Lock a mutex. It only succeeds if the key isn't already set, and it expires
+// on its own after `expires` seconds in case it's never unlocked.
+func (m *Memory) Lock(key, value string, expires int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lookupLock(key); ok {
+		return false
+	}
+	m.locks[key] = &item{
+		key:     key,
+		value:   []byte(value),
+		expires: expiry(expires),
+	}
+	return true
+}
+
+// Unlock a mutex.
+func (m *Memory) Unlock(key string) {
+	m.Delete(key)
+}
+
+// lookup finds a live key, removing it if it has expired. The caller must
+// hold the mutex.
+func (m *Memory) lookup(key string) (*list.Element, bool) {
+	e, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	it := e.Value.(*item)
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		m.remove(e)
+		return nil, false
+	}
+	return e, true
+}
+
+// lookupLock finds a held lock, removing it if it has expired. The caller must
+// hold the mutex.
+func (m *Memory) lookupLock(key string) (*item, bool) {
+	it, ok := m.locks[key]
+	if !ok {
+		return nil, false
+	}
+	if !it.expires.IsZero() && time.Now().After(it.expires) {
+		delete(m.locks, key)
+		return nil, false
+	}
+	return it, true
+}
+
+// expiry returns the time a key set now for `expires` seconds expires, or the
+// zero time if it's zero.
+func expiry(expires int) time.Time {
+	if expires > 0 {
+		return time.Now().Add(time.Duration(expires) * time.Second)
+	}
+	return time.Time{}
+}
+
+// set stores a key, evicting the least recently used keys if the cache is
+// full. The caller must hold the mutex.
+func (m *Memory) set(key string, v []byte, expires int) {
+	if e, ok := m.items[key]; ok {
+		it := e.Value.(*item)
+		it.value = v
+		it.expires = expiry(expires)
+		m.lru.MoveToFront(e)
+		return
+	}
+
+	m.items[key] = m.lru.PushFront(&item{
+		key:     key,
+		value:   v,
+		expires: expiry(expires),
+	})
+
+	for len(m.items) > m.maxKeys {
+		m.remove(m.lru.Back())
+	}
+}
+
+// remove drops an element from the cache. The caller must hold the mutex.
+func (m *Memory) remove(e *list.Element) {
+	m.lru.Remove(e)
+	delete(m.items, e.Value.(*item).key)
+}
+
+// globToRegexp converts a Redis style glob pattern into a regular expression.
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var (
+		re      strings.Builder
+		inClass bool
+	)
+	re.WriteString("^")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		if inClass {
+			switch c {
+			case ']':
+				inClass = false
+				re.WriteRune(c)
+			case '\\':
+				if i+1 < len(runes) {
+					i++
+					re.WriteString(regexp.QuoteMeta(string(runes[i])))
+				}
+			case '^':
+				re.WriteString(`\^`)
+			default:
+				re.WriteRune(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '*':
+			re.WriteString(".*")
+		case '?':
+			re.WriteString(".")
+		case '[':
+			inClass = true
+			re.WriteRune(c)
+			if i+1 < len(runes) && runes[i+1] == '^' {
+				// Redis spells negation the same way.
+				i++
+				re.WriteRune('^')
+			}
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				re.WriteString(regexp.QuoteMeta(string(runes[i])))
+			}
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if inClass {
+		return nil, errors.New("unterminated [ in pattern")
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
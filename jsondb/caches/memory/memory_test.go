@@ -0,0 +1,130 @@
+package memory_test
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb/caches"
+	"github.com/kirsle/blog/jsondb/caches/memory"
+)
+
+// Make sure it implements the whole interface.
+var _ caches.Cacher = &memory.Memory{}
+
+func TestGetSet(t *testing.T) {
+	m := memory.New(10)
+
+	if _, err := m.Get("missing"); err == nil {
+		t.Errorf("expected an error for a missing key")
+	}
+
+	m.Set("key", []byte("value"), 60)
+	if v, err := m.Get("key"); err != nil || string(v) != "value" {
+		t.Errorf("expected value, got %q (err: %v)", v, err)
+	}
+
+	m.Delete("key")
+	if _, err := m.Get("key"); err == nil {
+		t.Errorf("expected the key to be deleted")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	m := memory.New(10)
+	m.Set("short", []byte("x"), 1)
+	m.Set("forever", []byte("x"), 0)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	if _, err := m.Get("short"); err == nil {
+		t.Errorf("expected the key to have expired")
+	}
+	if _, err := m.Get("forever"); err != nil {
+		t.Errorf("a key with no expiry went missing")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	m := memory.New(3)
+	m.Set("a", []byte("a"), 60)
+	m.Set("b", []byte("b"), 60)
+	m.Set("c", []byte("c"), 60)
+
+	// Touch "a" so that "b" is the least recently used.
+	m.Get("a")
+	m.Set("d", []byte("d"), 60)
+
+	if _, err := m.Get("b"); err == nil {
+		t.Errorf("expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, err := m.Get(key); err != nil {
+			t.Errorf("expected %s to still be cached", key)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	m := memory.New(100)
+	for _, key := range []string{
+		"blog/index", "blog/posts/1", "blog/posts/12", "comments/threads/post-1",
+		"pygmentize:abc", "lock:blog/index",
+	} {
+		m.Set(key, []byte("x"), 60)
+	}
+
+	tests := map[string]string{
+		"*":             "blog/index blog/posts/1 blog/posts/12 comments/threads/post-1 lock:blog/index pygmentize:abc",
+		"blog/*":        "blog/index blog/posts/1 blog/posts/12",
+		"blog/posts/?":  "blog/posts/1",
+		"blog/posts/1*": "blog/posts/1 blog/posts/12",
+		"[bc]*index":    "blog/index",
+		"[^b]*":         "comments/threads/post-1 lock:blog/index pygmentize:abc",
+		"pygmentize:*":  "pygmentize:abc",
+		"nothing*":      "",
+	}
+	for pattern, expect := range tests {
+		keys, err := m.Keys(pattern)
+		if err != nil {
+			t.Errorf("Keys(%s): %s", pattern, err)
+			continue
+		}
+		sort.Strings(keys)
+		if got := strings.Join(keys, " "); got != expect {
+			t.Errorf("Keys(%s): expected %q, got %q", pattern, expect, got)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	m := memory.New(10)
+	if !m.Lock("lock:x", "1", 60) {
+		t.Fatalf("expected to get the lock")
+	}
+	if m.Lock("lock:x", "2", 60) {
+		t.Errorf("lock was acquired twice")
+	}
+	m.Unlock("lock:x")
+	if !m.Lock("lock:x", "3", 1) {
+		t.Errorf("expected to get the lock after unlocking")
+	}
+
+	// Filling the cache doesn't evict the lock.
+	for i := 0; i < 20; i++ {
+		m.Set(fmt.Sprintf("key-%d", i), []byte("x"), 60)
+	}
+	if m.Lock("lock:x", "4", 60) {
+		t.Errorf("lock was evicted by the cached data")
+	}
+	m.Unlock("lock:x")
+	m.Lock("lock:x", "3", 1)
+
+	// An abandoned lock expires on its own.
+	time.Sleep(1100 * time.Millisecond)
+	if !m.Lock("lock:x", "4", 60) {
+		t.Errorf("expected the abandoned lock to expire")
+	}
+}
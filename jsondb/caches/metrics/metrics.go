@@ -0,0 +1,163 @@
+// Package metrics wraps a cache backend to count how it's being used.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/jsondb/caches"
+)
+
+// Metrics is a caches.Cacher that passes everything through to another
+// backend while counting hits, misses, sets, deletes and lock waits, grouped
+// by the prefix of the key (i.e. "blog/", "comments/" or "pygmentize:").
+type Metrics struct {
+	Backend caches.Cacher
+
+	mu       sync.Mutex
+	counters map[string]*Counters
+	since    time.Time // when counting started
+}
+
+// Counters are the usage counts for one key prefix.
+type Counters struct {
+	Hits      int64
+	Misses    int64
+	Sets      int64
+	Deletes   int64
+	LockWaits int64 // Lock calls that found the key already held
+}
+
+// Stats are the counters for a key prefix, as returned by Metrics.Stats.
+type Stats struct {
+	Prefix string
+	Counters
+}
+
+// HitRate returns the percentage of Gets that were hits.
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total) * 100
+}
+
+// New wraps a cache backend with Metrics.
+func New(backend caches.Cacher) *Metrics {
+	return &Metrics{
+		Backend:  backend,
+		counters: map[string]*Counters{},
+		since:    time.Now(),
+	}
+}
+
+// Get a key from the backend.
+func (m *Metrics) Get(key string) ([]byte, error) {
+	v, err := m.Backend.Get(key)
+	m.count(key, func(c *Counters) {
+		if err == nil {
+			c.Hits++
+		} else {
+			c.Misses++
+		}
+	})
+	return v, err
+}
+
+// Set a key in the backend.
+func (m *Metrics) Set(key string, v []byte, expires int) error {
+	m.count(key, func(c *Counters) { c.Sets++ })
+	return m.Backend.Set(key, v, expires)
+}
+
+// Delete keys from the backend.
+func (m *Metrics) Delete(key ...string) {
+	for _, k := range key {
+		m.count(k, func(c *Counters) { c.Deletes++ })
+	}
+	m.Backend.Delete(key...)
+}
+
+// Keys returns a list of the backend's keys matching a pattern.
+func (m *Metrics) Keys(pattern string) ([]string, error) {
+	return m.Backend.Keys(pattern)
+}
+
+// Lock a mutex in the backend. A wait is counted under the prefix of the
+// document being locked, not under JsonDB's "lock:" prefix for the mutex keys.
+func (m *Metrics) Lock(key, value string, expires int) bool {
+	ok := m.Backend.Lock(key, value, expires)
+	if !ok {
+		document := strings.TrimPrefix(key, jsondb.CacheLockPrefix)
+		m.count(document, func(c *Counters) { c.LockWaits++ })
+	}
+	return ok
+}
+
+// Unlock a mutex in the backend.
+func (m *Metrics) Unlock(key string) {
+	m.Backend.Unlock(key)
+}
+
+// Stats returns the counters for every key prefix seen so far, sorted by
+// prefix.
+func (m *Metrics) Stats() []Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []Stats{}
+	for prefix, c := range m.counters {
+		result = append(result, Stats{
+			Prefix:   prefix,
+			Counters: *c,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Prefix < result[j].Prefix
+	})
+	return result
+}
+
+// Since returns when the counters were started, or last reset.
+func (m *Metrics) Since() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.since
+}
+
+// Reset clears all the counters.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters = map[string]*Counters{}
+	m.since = time.Now()
+}
+
+// count updates the counters for a key's prefix.
+func (m *Metrics) count(key string, fn func(*Counters)) {
+	prefix := Prefix(key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.counters[prefix]
+	if !ok {
+		c = &Counters{}
+		m.counters[prefix] = c
+	}
+	fn(c)
+}
+
+// Prefix returns the group a cache key is counted under: everything up to and
+// including its first slash or colon. So "blog/posts/1" is under "blog/" and
+// "pygmentize:abc123" is under "pygmentize:".
+func Prefix(key string) string {
+	if i := strings.IndexAny(key, "/:"); i >= 0 {
+		return key[:i+1]
+	}
+	return key
+}
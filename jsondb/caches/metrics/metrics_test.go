@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/jsondb/caches/memory"
+	"github.com/kirsle/blog/jsondb/caches/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New(memory.New(100))
+
+	m.Set("blog/index", []byte("x"), 60)
+	m.Get("blog/index")
+	m.Get("blog/posts/1")
+	m.Get("pygmentize:abc")
+	m.Delete("blog/index")
+	m.Lock(jsondb.CacheLockPrefix+"blog/index", "1", 60)
+	m.Lock(jsondb.CacheLockPrefix+"blog/index", "2", 60)
+	m.Lock(jsondb.CacheLockPrefix+"comments/threads/post-1", "1", 60)
+	m.Lock(jsondb.CacheLockPrefix+"comments/threads/post-1", "2", 60)
+
+	// Lock waits count under the document's prefix.
+	expect := map[string]metrics.Counters{
+		"blog/":       {Hits: 1, Misses: 1, Sets: 1, Deletes: 1, LockWaits: 1},
+		"comments/":   {LockWaits: 1},
+		"pygmentize:": {Misses: 1},
+	}
+
+	stats := m.Stats()
+	if len(stats) != len(expect) {
+		t.Errorf("expected %d prefixes, got %+v", len(expect), stats)
+	}
+	for _, s := range stats {
+		if s.Counters != expect[s.Prefix] {
+			t.Errorf("%s: expected %+v, got %+v", s.Prefix, expect[s.Prefix], s.Counters)
+		}
+	}
+
+	started := m.Since()
+	m.Reset()
+	if len(m.Stats()) != 0 {
+		t.Errorf("expected no stats after Reset")
+	}
+	if m.Since().Before(started) {
+		t.Errorf("expected Reset to restart the clock")
+	}
+
+	// The clock can be read while it's being reset.
+	done := make(chan bool)
+	go func() {
+		m.Reset()
+		close(done)
+	}()
+	m.Since()
+	<-done
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
@@ -60,17 +61,23 @@ func (r *Redis) Delete(key ...string) {
 	conn := r.pool.Get()
 
 	for _, v := range key {
-		conn.Send("DEL", v)
+		conn.Send("DEL", r.prefix+v)
 	}
 	conn.Flush()
-	conn.Receive()
+	for range key {
+		conn.Receive()
+	}
 }
 
-// Keys returns a list of Redis keys matching a pattern.
+// Keys returns a list of Redis keys matching a pattern. Both the pattern and
+// the keys returned are relative to the key prefix, the same as for Get/Set.
 func (r *Redis) Keys(pattern string) ([]string, error) {
 	conn := r.pool.Get()
 
-	n, err := redis.Strings(conn.Do("KEYS", pattern))
+	n, err := redis.Strings(conn.Do("KEYS", r.prefix+pattern))
+	for i, key := range n {
+		n[i] = strings.TrimPrefix(key, r.prefix)
+	}
 	return n, err
 }
 
@@ -78,8 +85,9 @@ func (r *Redis) Keys(pattern string) ([]string, error) {
 func (r *Redis) Lock(key, value string, expires int) bool {
 	conn := r.pool.Get()
 
-	n, err := redis.Int(conn.Do("SETNX", r.prefix+key, value))
-	return err == nil && n == 1
+	// SET with NX and EX so a lock held by a crashed process still expires.
+	n, err := redis.String(conn.Do("SET", r.prefix+key, value, "NX", "EX", expires))
+	return err == nil && n == "OK"
 }
 
 // Unlock a mutex.
@@ -0,0 +1,252 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+)
+
+// Index declares a secondary index over one field of the documents in a
+// collection (the documents directly under a path, like "blog/posts").
+//
+// Once registered, every DB keeps an index document up to date whenever a
+// document in the collection is committed or deleted, and the documents can
+// be looked up by the field's value with DB.FindBy.
+type Index struct {
+	Collection string // i.e. "blog/posts"
+	Field      string // i.e. "fragment"
+
+	// New returns a pointer to a blank document of the collection's type.
+	// Committed documents are decoded into it before calling Values.
+	New func() interface{}
+
+	// Values returns the indexed values of the field for a document. A field
+	// like a list of tags may have several.
+	Values func(v interface{}) []string
+}
+
+// indexDocument is the stored form of a secondary index.
+type indexDocument struct {
+	Values    map[string][]string `json:"values"`    // field value -> documents
+	Documents map[string][]string `json:"documents"` // document -> field values
+}
+
+// Registered indexes.
+var (
+	indexes   []*Index
+	indexesMu sync.RWMutex
+)
+
+// RegisterIndex declares a secondary index. Models should call this from their
+// init() functions.
+func RegisterIndex(idx Index) {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+	indexes = append(indexes, &idx)
+}
+
+// FindBy returns the names of the documents in a collection whose indexed
+// field has the given value.
+func (db *DB) FindBy(collection, field, value string) ([]string, error) {
+	values, err := db.IndexValues(collection, field)
+	if err != nil {
+		return nil, err
+	}
+	return values[value], nil
+}
+
+// IndexValues returns every value of an indexed field, mapped to the names of
+// the documents that have it.
+func (db *DB) IndexValues(collection, field string) (map[string][]string, error) {
+	idx := findIndex(collection, field)
+	if idx == nil {
+		return nil, ErrNoIndex
+	}
+
+	document := idx.document()
+	lock := db.lockFor(document)
+
+	lock.RLock()
+	if db.Exists(document) {
+		doc := &indexDocument{}
+		err := db.get(document, doc)
+		lock.RUnlock()
+		return doc.Values, err
+	}
+	lock.RUnlock()
+
+	// Build the index the first time it's needed.
+	defer db.beginWrite()()
+	lock.Lock()
+	defer lock.Unlock()
+	doc, err := db.loadIndex(idx)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Values, db.commit(document, doc)
+}
+
+// document returns the name of the index's own document.
+func (idx *Index) document() string {
+	return path.Join("_index", idx.Collection, idx.Field)
+}
+
+// contains returns whether a document is in the index's collection.
+func (idx *Index) contains(document string) bool {
+	return path.Dir(document) == idx.Collection
+}
+
+// findIndex looks up a registered index.
+func findIndex(collection, field string) *Index {
+	indexesMu.RLock()
+	defer indexesMu.RUnlock()
+	for _, idx := range indexes {
+		if idx.Collection == collection && idx.Field == field {
+			return idx
+		}
+	}
+	return nil
+}
+
+// indexesFor returns the indexes that cover any of the given documents.
+func indexesFor(documents []string) []*Index {
+	indexesMu.RLock()
+	defer indexesMu.RUnlock()
+
+	var result []*Index
+	for _, idx := range indexes {
+		for _, document := range documents {
+			if idx.contains(document) {
+				result = append(result, idx)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// withIndexes returns the documents along with the documents of the indexes
+// that cover them.
+func withIndexes(documents []string) []string {
+	result := append([]string{}, documents...)
+	for _, idx := range indexesFor(documents) {
+		result = append(result, idx.document())
+	}
+	return result
+}
+
+// indexOps returns the operations to bring the indexes up to date with a
+// transaction. The caller must hold the locks on the index documents.
+func (db *DB) indexOps(ops []txOp, affected []*Index) ([]txOp, error) {
+	var result []txOp
+	for _, idx := range affected {
+		doc, err := db.loadIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, op := range ops {
+			if !idx.contains(op.Document) {
+				continue
+			}
+
+			var values []string
+			if !op.Delete {
+				v := idx.New()
+				if err := json.Unmarshal(op.Data, v); err != nil {
+					return nil, fmt.Errorf("indexing %s: %s", op.Document, err)
+				}
+				values = idx.Values(v)
+			}
+			doc.set(op.Document, values)
+		}
+
+		data, err := encodeJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, txOp{
+			Document: idx.document(),
+			Data:     data,
+		})
+	}
+	return result, nil
+}
+
+// loadIndex loads an index document, or builds it from scratch by scanning
+// its collection if it doesn't exist yet. The caller must hold its lock.
+func (db *DB) loadIndex(idx *Index) (*indexDocument, error) {
+	doc := &indexDocument{}
+	err := db.get(idx.document(), doc)
+	if err == nil {
+		if doc.Values == nil {
+			doc.Values = map[string][]string{}
+		}
+		if doc.Documents == nil {
+			doc.Documents = map[string][]string{}
+		}
+		return doc, nil
+	} else if err != ErrNotFound {
+		return nil, err
+	}
+
+	log.Info("[JsonDB] Building index on %s.%s", idx.Collection, idx.Field)
+	doc = &indexDocument{
+		Values:    map[string][]string{},
+		Documents: map[string][]string{},
+	}
+
+	documents, _ := db.List(idx.Collection)
+	for _, document := range documents {
+		// Read straight from disk; some of these may be locked by the
+		// transaction that needs the index.
+		data, err := ioutil.ReadFile(db.toPath(document))
+		if err != nil {
+			return nil, err
+		}
+
+		v := idx.New()
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, fmt.Errorf("indexing %s: %s", document, err)
+		}
+		doc.set(document, idx.Values(v))
+	}
+
+	return doc, nil
+}
+
+// set replaces the indexed values for a document. No values removes the
+// document from the index.
+func (doc *indexDocument) set(document string, values []string) {
+	// Remove the old values.
+	for _, value := range doc.Documents[document] {
+		var keep []string
+		for _, name := range doc.Values[value] {
+			if name != document {
+				keep = append(keep, name)
+			}
+		}
+		if len(keep) > 0 {
+			doc.Values[value] = keep
+		} else {
+			delete(doc.Values, value)
+		}
+	}
+	delete(doc.Documents, document)
+
+	// Add the new ones, skipping duplicates.
+	seen := map[string]bool{}
+	for _, value := range values {
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+
+		doc.Values[value] = append(doc.Values[value], document)
+		sort.Strings(doc.Values[value])
+		doc.Documents[document] = append(doc.Documents[document], value)
+	}
+}
@@ -2,6 +2,7 @@
 package jsondb
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,30 +11,58 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/kirsle/blog/jsondb/caches"
 )
 
 var (
 	// CacheTimeout is how long the Redis cache keys live for in seconds, default 2 hours.
 	CacheTimeout = 60 * 60 * 2
-	CacheLock    sync.RWMutex
 )
 
 // DB is the database manager.
 type DB struct {
 	Root  string        // The root directory of the database
 	Cache caches.Cacher // A cacher for the JSON documents, i.e. Redis
+
+	// Per-document read/write locks.
+	locks   map[string]*sync.RWMutex
+	locksMu sync.Mutex
+
+	// Held for reading by every write, and for writing by Snapshot.
+	writers sync.RWMutex
+
+	// Filesystem watcher for cache invalidation; see Watch.
+	watching  int32  // set while Get may trust the cache
+	evictions uint32 // counts the watcher's evictions; see get
+	watcher   *fsnotify.Watcher
+	watchMu   sync.Mutex
 }
 
 // Error codes returned.
 var (
 	ErrNotFound = errors.New("document not found")
+	ErrNoIndex  = errors.New("no such index")
 )
 
 // New initializes the JSON database.
+//
+// If a transaction was interrupted the last time the database was open, it is
+// recovered from the journal before New returns.
 func New(root string) *DB {
+	db := Open(root)
+	db.Recover()
+	return db
+}
+
+// Open initializes the JSON database without recovering any interrupted
+// transactions. Use it when another process, like a running server, may have
+// the database open: the journals could be for its transactions that are
+// still in progress. The process that owns the database calls Recover.
+func Open(root string) *DB {
 	log.Info("Initialized JsonDB at root: %s", root)
 	return &DB{
 		Root: root,
@@ -49,6 +78,30 @@ func (db *DB) WithCache(cache caches.Cacher) *DB {
 // Get a document by path and load it into the object `v`.
 func (db *DB) Get(document string, v interface{}) error {
 	log.Debug("[JsonDB] GET %s", document)
+
+	// Get a lock for reading.
+	lock := db.lockFor(document)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return db.get(document, v)
+}
+
+// get loads a document; the caller must hold its lock.
+func (db *DB) get(document string, v interface{}) error {
+	// When the file watcher is running it evicts changed documents from the
+	// cache, so a cached copy can be trusted without a trip to the disk.
+	if db.isWatching() {
+		if data, err := db.GetCache(document); err == nil {
+			log.Debug("[JsonDB] %s: Returning cached copy", document)
+			return db.decode(document, []byte(data), v)
+		}
+	}
+
+	// The watcher may evict the document while it's being read from disk,
+	// before the copy read here is cached; see the end.
+	evictions := atomic.LoadUint32(&db.evictions)
+
 	if !db.Exists(document) {
 		return ErrNotFound
 	}
@@ -74,69 +127,152 @@ func (db *DB) Get(document string, v interface{}) error {
 				db.DeleteCache(document + "_mtime")
 			} else {
 				log.Debug("[JsonDB] %s: Returning cached copy", document)
-				return json.Unmarshal([]byte(data), v)
+				return db.decode(document, []byte(data), v)
 			}
 		}
 	}
 
-	// Get a lock for reading.
-	CacheLock.RLock()
-
-	// Read the JSON.
-	err = db.readJSON(path, &v)
+	// Read the JSON, bringing it up to date with the current schema.
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	raw, _, err = migrateData(document, raw)
 	if err != nil {
-		CacheLock.RUnlock()
+		return err
+	}
+	if err = json.Unmarshal(raw, v); err != nil {
 		return err
 	}
 
-	// Unlock & cache it.
-	db.SetJSONCache(document, v, CacheTimeout)
+	// Cache it.
+	db.SetCache(document, string(raw), CacheTimeout)
 	db.SetCache(document+"_mtime", stat.ModTime().Format(time.RFC3339Nano), CacheTimeout)
-	CacheLock.RUnlock()
+
+	// If the watcher evicted anything since, this copy may be older than a
+	// change that it's already done with, and would be trusted for as long
+	// as it's cached. Evict it again to be safe.
+	if atomic.LoadUint32(&db.evictions) != evictions {
+		db.DeleteCache(document)
+		db.DeleteCache(document + "_mtime")
+	}
 
 	return nil
 }
 
+// decode loads a cached copy of a document into `v`. The cache may have been
+// filled by an older version of the app, so pending migrations are run on it
+// first.
+func (db *DB) decode(document string, data []byte, v interface{}) error {
+	data, _, err := migrateData(document, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
 // Commit writes a JSON object to the database.
 func (db *DB) Commit(document string, v interface{}) error {
 	log.Debug("[JsonDB] COMMIT %s", document)
-	path := db.toPath(document)
+	defer db.beginWrite()()
 
-	// Get a write lock for the cache.
-	CacheLock.Lock()
+	// Get a write lock on the document, and on its indexes if it has any.
+	unlock := db.lockWithIndexes(document)
+	defer unlock()
+
+	return db.commit(document, v)
+}
+
+// commit writes a document; the caller must hold its lock and the locks on
+// its indexes, from lockWithIndexes.
+func (db *DB) commit(document string, v interface{}) error {
+	data, err := encodeDocument(document, v)
+	if err != nil {
+		return fmt.Errorf("failed to encode document %s: %s", document, err)
+	}
+
+	// Documents with secondary indexes are written along with their indexes.
+	if len(indexesFor([]string{document})) > 0 {
+		return db.applyLocked([]txOp{{Document: document, Data: data}})
+	}
+
+	path := db.toPath(document)
 
 	// Ensure the directory tree is ready.
-	err := db.makePath(path)
+	err = db.makePath(path)
 	if err != nil {
-		CacheLock.Unlock()
 		return err
 	}
 
 	// Write the document.
-	err = db.writeJSON(path, v)
+	err = writeFile(path, data)
 	if err != nil {
-		CacheLock.Unlock()
 		return fmt.Errorf("failed to write JSON to path %s: %s", path, err.Error())
 	}
 
-	// Unlock & cache it.
-	db.SetJSONCache(document, v, CacheTimeout)
+	// Cache it.
+	db.SetCache(document, string(data), CacheTimeout)
 	db.SetCache(document+"_mtime", time.Now().Format(time.RFC3339Nano), CacheTimeout)
-	CacheLock.Unlock()
 
 	return nil
 }
 
+// Update loads a document into `v`, calls `fn` to modify it, and commits the
+// result, all while holding the document's lock so that concurrent updates
+// can't lose each other's changes.
+//
+// If the document doesn't exist yet, `v` is left as-is for `fn` to fill in.
+// If `fn` returns an error, nothing is written and the error is returned.
+// `fn` must not write to the database itself.
+//
+// When the database has a cache configured (i.e. Redis), the cache lock is
+// also held so that other processes sharing the cache are kept out, too.
+func (db *DB) Update(document string, v interface{}, fn func() error) error {
+	log.Debug("[JsonDB] UPDATE %s", document)
+	defer db.beginWrite()()
+
+	unlock := db.lockWithIndexes(document)
+	defer unlock()
+
+	if !db.LockCache(document) {
+		return fmt.Errorf("timed out waiting for the lock on %s", document)
+	}
+	defer db.UnlockCache(document)
+
+	// Load the current copy of the document.
+	if db.Exists(document) {
+		reset(v)
+		if err := db.get(document, v); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return db.commit(document, v)
+}
+
 // Delete removes a JSON document from the database.
 func (db *DB) Delete(document string) error {
 	log.Debug("[JsonDB] DELETE %s", document)
+	defer db.beginWrite()()
 	path := db.toPath(document)
 
+	unlock := db.lockWithIndexes(document)
+	defer unlock()
+
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		log.Warn("Delete document %s: did not exist")
+		log.Warn("Delete document %s: did not exist", document)
 		return nil
 	}
 
+	// Documents with secondary indexes are removed from them too.
+	if len(indexesFor([]string{document})) > 0 {
+		return db.applyLocked([]txOp{{Document: document, Delete: true}})
+	}
+
 	db.DeleteCache(document)
 	return os.Remove(path)
 }
@@ -211,32 +347,83 @@ func (db *DB) list(path string, recursive bool) ([]string, error) {
 	return docs, nil
 }
 
-// readJSON reads a JSON file from disk.
-func (db *DB) readJSON(path string, v interface{}) error {
-	fh, err := os.Open(path)
+// encodeJSON serializes a document the way it is stored on disk.
+func encodeJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "\t")
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeDocument serializes a document for storage, stamping it with its
+// schema version if its collection has migrations.
+func encodeDocument(document string, v interface{}) ([]byte, error) {
+	data, err := encodeJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return stampSchema(document, data)
+}
+
+// writeFile atomically replaces the file at path with the given data.
+//
+// The data is written to a temporary file in the same directory, synced to
+// disk and then renamed over the target path, so that a crash mid-write can
+// never leave a truncated or half-written document behind.
+func writeFile(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+
+	// The temp file name must not end in .json or list() would pick it up.
+	fh, err := ioutil.TempFile(dir, "."+name+".tmp")
 	if err != nil {
 		return err
 	}
-	defer fh.Close()
+	tmp := fh.Name()
+
+	// Clean up the temp file on any failure below.
+	var committed bool
+	defer func() {
+		if !committed {
+			fh.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	if _, err = fh.Write(data); err != nil {
+		return err
+	}
+	if err = fh.Sync(); err != nil {
+		return err
+	}
+	if err = fh.Close(); err != nil {
+		return err
+	}
 
-	decoder := json.NewDecoder(fh)
-	err = decoder.Decode(&v)
-	return err
+	// ioutil.TempFile creates files as 0600; match os.Create's permissions.
+	if err = os.Chmod(tmp, 0644); err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	committed = true
+
+	// Sync the directory so the rename itself survives a crash.
+	return syncDir(dir)
 }
 
-// writeJSON writes a JSON document to disk.
-func (db *DB) writeJSON(path string, v interface{}) error {
-	fh, err := os.Create(path)
+// syncDir flushes a directory's entries to disk.
+func syncDir(dir string) error {
+	fh, err := os.Open(dir)
 	if err != nil {
 		return err
 	}
 	defer fh.Close()
-
-	encoder := json.NewEncoder(fh)
-	encoder.SetIndent("", "\t")
-	encoder.Encode(v)
-
-	return nil
+	return fh.Sync()
 }
 
 // toPath translates a document name into a filesystem path.
@@ -0,0 +1,506 @@
+package jsondb_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+)
+
+type testDoc struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// newTestDB creates a JsonDB in a temporary directory.
+func newTestDB(t *testing.T) (*jsondb.DB, func()) {
+	root, err := ioutil.TempDir("", "jsondb-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	return jsondb.New(root), func() {
+		os.RemoveAll(root)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Write a document, then overwrite it.
+	for i := 1; i <= 2; i++ {
+		err := db.Commit("test/doc", testDoc{"hello", i})
+		if err != nil {
+			t.Fatalf("Commit #%d: %s", i, err)
+		}
+	}
+
+	doc := testDoc{}
+	if err := db.Get("test/doc", &doc); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if doc.Name != "hello" || doc.Count != 2 {
+		t.Errorf("unexpected document: %+v", doc)
+	}
+
+	// No temporary files should be left behind.
+	files, _ := ioutil.ReadDir(filepath.Join(db.Root, "test"))
+	if len(files) != 1 || files[0].Name() != "doc.json" {
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name())
+		}
+		t.Errorf("expected only doc.json on disk, got: %v", names)
+	}
+}
+
+func TestCommitEncodeError(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if err := db.Commit("test/doc", testDoc{"original", 1}); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	// Channels can't be encoded to JSON, so this Commit must fail and leave
+	// the original document untouched.
+	err := db.Commit("test/doc", map[string]interface{}{
+		"bad": make(chan int),
+	})
+	if err == nil {
+		t.Fatalf("expected an error committing an unencodable document")
+	}
+
+	doc := testDoc{}
+	if err := db.Get("test/doc", &doc); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if doc.Name != "original" {
+		t.Errorf("original document was clobbered: %+v", doc)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	if err := db.Commit("test/old", testDoc{"old", 1}); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	// A transaction that fails writes nothing.
+	err := db.Transaction(func(tx *jsondb.Tx) error {
+		tx.Commit("test/a", testDoc{"a", 1})
+		tx.Delete("test/old")
+		return errors.New("changed my mind")
+	})
+	if err == nil {
+		t.Errorf("expected the transaction's error to be returned")
+	}
+	if db.Exists("test/a") || !db.Exists("test/old") {
+		t.Errorf("failed transaction modified the database")
+	}
+
+	// A successful one writes everything.
+	err = db.Transaction(func(tx *jsondb.Tx) error {
+		tx.Commit("test/a", testDoc{"a", 1})
+		tx.Commit("test/b", testDoc{"b", 1})
+		tx.Commit("test/b", testDoc{"b", 2}) // replaces the previous op
+		tx.Delete("test/old")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction: %s", err)
+	}
+
+	doc := testDoc{}
+	if err := db.Get("test/b", &doc); err != nil || doc.Count != 2 {
+		t.Errorf("expected test/b to have count 2, got %+v (err: %v)", doc, err)
+	}
+	if !db.Exists("test/a") || db.Exists("test/old") {
+		t.Errorf("transaction was not fully applied")
+	}
+	if journals, _ := ioutil.ReadDir(filepath.Join(db.Root, ".journal")); len(journals) > 0 {
+		t.Errorf("transaction journal was left behind")
+	}
+}
+
+func TestTransactionOn(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Each transaction writes a document of its own and bumps a shared counter
+	// read inside the transaction; none of the bumps may be lost.
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			own := fmt.Sprintf("test/item-%d", i)
+			err := db.TransactionOn([]string{own, "test/total"}, func(tx *jsondb.Tx) error {
+				total := testDoc{Name: "total"}
+				if err := tx.Get("test/total", &total); err != nil && err != jsondb.ErrNotFound {
+					return err
+				}
+				total.Count++
+				tx.Commit(own, testDoc{own, i})
+				return tx.Commit("test/total", total)
+			})
+			if err != nil {
+				t.Errorf("TransactionOn: %s", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	doc := testDoc{}
+	if err := db.Get("test/total", &doc); err != nil || doc.Count != workers {
+		t.Errorf("expected total %d, got %+v (err: %v)", workers, doc, err)
+	}
+
+	// Documents that weren't locked can't be read or changed.
+	err := db.TransactionOn([]string{"test/total"}, func(tx *jsondb.Tx) error {
+		return tx.Get("test/item-0", &doc)
+	})
+	if err == nil {
+		t.Error("expected an error reading a document that wasn't locked")
+	}
+	err = db.TransactionOn([]string{"test/total"}, func(tx *jsondb.Tx) error {
+		tx.Delete("test/item-0")
+		return nil
+	})
+	if err == nil || !db.Exists("test/item-0") {
+		t.Errorf("expected an error deleting a document that wasn't locked (err: %v)", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Many concurrent read-modify-write cycles must not lose any updates.
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			doc := &testDoc{Name: "counter"}
+			err := db.Update("test/counter", doc, func() error {
+				doc.Count++
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Update: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	doc := testDoc{}
+	if err := db.Get("test/counter", &doc); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if doc.Count != workers {
+		t.Errorf("expected count %d, got %d", workers, doc.Count)
+	}
+
+	// An error from the callback aborts the write.
+	err := db.Update("test/counter", &doc, func() error {
+		doc.Count = 0
+		return errors.New("nope")
+	})
+	if err == nil {
+		t.Errorf("expected Update to return the callback's error")
+	}
+	db.Get("test/counter", &doc)
+	if doc.Count != workers {
+		t.Errorf("aborted Update was written: count is %d", doc.Count)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// A document written before the index exists should get picked up when
+	// the index is first built.
+	if err := db.Commit("indexed/1", testDoc{"alpha", 1}); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "indexed",
+		Field:      "name",
+		New:        func() interface{} { return &testDoc{} },
+		Values: func(v interface{}) []string {
+			return []string{v.(*testDoc).Name}
+		},
+	})
+
+	expect := func(value string, docs ...string) {
+		t.Helper()
+		result, err := db.FindBy("indexed", "name", value)
+		if err != nil {
+			t.Fatalf("FindBy(%s): %s", value, err)
+		}
+		if strings.Join(result, ",") != strings.Join(docs, ",") {
+			t.Errorf("FindBy(%s): expected %v, got %v", value, docs, result)
+		}
+	}
+
+	expect("alpha", "indexed/1")
+
+	db.Commit("indexed/2", testDoc{"beta", 1})
+	db.Commit("indexed/3", testDoc{"beta", 2})
+	expect("beta", "indexed/2", "indexed/3")
+
+	// Changing and deleting documents moves them in the index.
+	db.Commit("indexed/1", testDoc{"beta", 3})
+	db.Delete("indexed/2")
+	expect("alpha")
+	expect("beta", "indexed/1", "indexed/3")
+
+	// Documents outside of the collection aren't indexed.
+	db.Commit("indexed/sub/4", testDoc{"beta", 4})
+	expect("beta", "indexed/1", "indexed/3")
+
+	if _, err := db.FindBy("indexed", "count", "1"); err != jsondb.ErrNoIndex {
+		t.Errorf("expected ErrNoIndex for an unindexed field, got: %v", err)
+	}
+}
+
+func TestIndexConcurrentWrites(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "racing",
+		Field:      "name",
+		New:        func() interface{} { return &testDoc{} },
+		Values: func(v interface{}) []string {
+			return []string{v.(*testDoc).Name}
+		},
+	})
+
+	// Single-document writes lock the document and then the index, while a
+	// transaction locks both at once; they mustn't deadlock each other.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				db.Commit("racing/1", testDoc{"commit", j})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				doc := &testDoc{}
+				db.Update("racing/2", doc, func() error {
+					doc.Name = "update"
+					doc.Count++
+					return nil
+				})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				db.Commit("racing/3", testDoc{"delete", j})
+				db.Delete("racing/3")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				db.Transaction(func(tx *jsondb.Tx) error {
+					tx.Commit("racing/1", testDoc{"tx", j})
+					return tx.Commit("racing/2", testDoc{"tx", j})
+				})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("concurrent writes to an indexed collection deadlocked")
+	}
+
+	if docs, _ := db.FindBy("racing", "name", "delete"); len(docs) != 0 {
+		t.Errorf("expected the deleted document to be gone from the index, got %v", docs)
+	}
+}
+
+func TestNextSequence(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// A new sequence picks up after the existing documents.
+	db.Commit("numbered/3", testDoc{"three", 3})
+	db.Commit("numbered/7", testDoc{"seven", 7})
+	db.Commit("numbered/readme", testDoc{"not a number", 0})
+
+	next := func() int {
+		t.Helper()
+		id, err := db.NextSequence("numbered")
+		if err != nil {
+			t.Fatalf("NextSequence: %s", err)
+		}
+		return id
+	}
+
+	if id := next(); id != 8 {
+		t.Errorf("expected first ID to be 8, got %d", id)
+	}
+
+	// Deleting the highest document doesn't give its ID out again.
+	db.Commit("numbered/9", testDoc{"nine", 9})
+	if id := next(); id != 9 {
+		t.Errorf("expected 9, got %d", id)
+	}
+	db.Delete("numbered/9")
+	if id := next(); id != 10 {
+		t.Errorf("expected 10 after deleting 9, got %d", id)
+	}
+
+	// Concurrent callers all get unique numbers.
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = map[int]bool{}
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, err := db.NextSequence("numbered")
+			if err != nil {
+				t.Errorf("NextSequence: %s", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[id] {
+				t.Errorf("ID %d was handed out twice", id)
+			}
+			seen[id] = true
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMigration(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Two old documents written before the collection had a schema.
+	for _, name := range []string{"one", "two"} {
+		os.MkdirAll(filepath.Join(db.Root, "migrate"), 0755)
+		ioutil.WriteFile(
+			filepath.Join(db.Root, "migrate", name+".json"),
+			[]byte(`{"title": "`+name+`", "count": 5}`),
+			0644,
+		)
+	}
+
+	// Version 1 renames "title" to "name"; version 2 resets the count.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "migrate",
+		Version:    2,
+		Migrate: func(doc map[string]interface{}) error {
+			doc["count"] = 1
+			return nil
+		},
+	})
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "migrate",
+		Version:    1,
+		Migrate: func(doc map[string]interface{}) error {
+			if _, ok := doc["name"]; ok {
+				return errors.New("already has a name")
+			}
+			doc["name"] = doc["title"]
+			delete(doc, "title")
+			return nil
+		},
+	})
+
+	// Migrated lazily on Get, without touching the disk.
+	doc := testDoc{}
+	if err := db.Get("migrate/one", &doc); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if doc.Name != "one" || doc.Count != 1 {
+		t.Errorf("unexpected document after lazy migration: %+v", doc)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(db.Root, "migrate", "one.json"))
+	if !strings.Contains(string(data), `"title"`) {
+		t.Errorf("Get should not have rewritten the file: %s", data)
+	}
+
+	// Migrated in bulk.
+	count, err := db.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 documents migrated, got %d", count)
+	}
+	data, _ = ioutil.ReadFile(filepath.Join(db.Root, "migrate", "two.json"))
+	if !strings.Contains(string(data), `"_schema": 2`) || strings.Contains(string(data), `"title"`) {
+		t.Errorf("unexpected document after bulk migration: %s", data)
+	}
+
+	// Nothing left to do the second time, and the migrations don't run again.
+	if count, err = db.Migrate(); err != nil || count != 0 {
+		t.Errorf("second Migrate: expected 0 documents, got %d (err: %v)", count, err)
+	}
+	if err := db.Get("migrate/two", &doc); err != nil {
+		t.Errorf("Get after Migrate: %s", err)
+	}
+
+	// New documents are stamped with the latest version.
+	db.Commit("migrate/three", testDoc{"three", 3})
+	data, _ = ioutil.ReadFile(filepath.Join(db.Root, "migrate", "three.json"))
+	if !strings.Contains(string(data), `"_schema": 2`) {
+		t.Errorf("new document wasn't stamped with its schema version: %s", data)
+	}
+
+	// Documents left in a retired collection are deleted.
+	db.Commit("retired/a", testDoc{"a", 1})
+	db.Commit("retired/b", testDoc{"b", 2})
+	jsondb.RetireCollection("retired")
+	if count, err = db.Migrate(); err != nil || count != 2 {
+		t.Errorf("Migrate with a retired collection: expected 2 documents, got %d (err: %v)", count, err)
+	}
+	if db.Exists("retired/a") || db.Exists("retired/b") {
+		t.Error("documents in the retired collection were left behind")
+	}
+
+	// So is a single retired document, leaving the rest of its collection.
+	db.Commit("retiring/c", testDoc{"c", 3})
+	db.Commit("retiring/d", testDoc{"d", 4})
+	jsondb.RetireCollection("retiring/c")
+	if count, err = db.Migrate(); err != nil || count != 1 {
+		t.Errorf("Migrate with a retired document: expected 1 document, got %d (err: %v)", count, err)
+	}
+	if db.Exists("retiring/c") || !db.Exists("retiring/d") {
+		t.Error("expected only the retired document to be deleted")
+	}
+}
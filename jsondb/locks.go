@@ -0,0 +1,68 @@
+package jsondb
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// lockFor returns the read/write lock for a document.
+func (db *DB) lockFor(document string) *sync.RWMutex {
+	db.locksMu.Lock()
+	defer db.locksMu.Unlock()
+
+	if db.locks == nil {
+		db.locks = map[string]*sync.RWMutex{}
+	}
+
+	lock, ok := db.locks[document]
+	if !ok {
+		lock = &sync.RWMutex{}
+		db.locks[document] = lock
+	}
+	return lock
+}
+
+// lockAll write-locks a set of documents and returns a function to unlock
+// them again. The locks are always taken in sorted order so that two callers
+// locking overlapping sets of documents can't deadlock, which only holds if
+// neither caller already has a lock when it calls lockAll.
+func (db *DB) lockAll(documents []string) func() {
+	sorted := make([]string, 0, len(documents))
+	seen := map[string]bool{}
+	for _, document := range documents {
+		if !seen[document] {
+			seen[document] = true
+			sorted = append(sorted, document)
+		}
+	}
+	sort.Strings(sorted)
+
+	var locks []*sync.RWMutex
+	for _, document := range sorted {
+		lock := db.lockFor(document)
+		lock.Lock()
+		locks = append(locks, lock)
+	}
+
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+// lockWithIndexes write-locks documents along with the documents of the
+// secondary indexes that cover them, so they can be written with applyLocked.
+func (db *DB) lockWithIndexes(documents ...string) func() {
+	return db.lockAll(withIndexes(documents))
+}
+
+// reset sets the value that the pointer `v` points to back to its zero value,
+// so that a document decoded into it doesn't get mixed with stale data.
+func reset(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+}
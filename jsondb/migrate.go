@@ -0,0 +1,247 @@
+package jsondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"sync"
+)
+
+// SchemaKey is the field JsonDB stamps into documents to record their schema
+// version. Documents without it are version 0.
+const SchemaKey = "_schema"
+
+// Migration upgrades documents in a collection to a new schema version.
+//
+// The document is given as a generic JSON object; numbers in it are
+// json.Number values. The function modifies it in place.
+type Migration struct {
+	// A collection (i.e. "blog/posts") or a single document
+	// (i.e. "app/settings") that the migration applies to.
+	Collection string
+
+	// The schema version this migration brings the document up to.
+	Version int
+
+	Migrate func(doc map[string]interface{}) error
+}
+
+// Registered migrations, sorted by collection and version, and retired
+// collections.
+var (
+	migrations   []Migration
+	retired      []string
+	migrationsMu sync.RWMutex
+)
+
+// RegisterMigration adds a schema migration. Models should call this from
+// their init() functions.
+//
+// Once a collection has migrations, every document committed to it is
+// stamped with the latest version. Older documents are upgraded on the fly
+// when they're loaded, or all at once by DB.Migrate.
+func RegisterMigration(m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	migrations = append(migrations, m)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		if migrations[i].Collection != migrations[j].Collection {
+			return migrations[i].Collection < migrations[j].Collection
+		}
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// RetireCollection declares that the documents in a collection, or a single
+// document, aren't used anymore, i.e. because an index replaced them. Models
+// should call this from their init() functions, and DB.RemoveRetired deletes
+// any that are left.
+func RetireCollection(collection string) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	retired = append(retired, collection)
+}
+
+// RemoveRetired deletes the documents left in retired collections. It returns
+// the number of documents deleted.
+func (db *DB) RemoveRetired() (int, error) {
+	migrationsMu.RLock()
+	collections := append([]string{}, retired...)
+	migrationsMu.RUnlock()
+
+	var count int
+	for _, collection := range collections {
+		var documents []string
+		if db.Exists(collection) {
+			documents = []string{collection}
+		} else {
+			documents, _ = db.List(collection)
+		}
+		for _, document := range documents {
+			if err := db.Delete(document); err != nil {
+				return count, err
+			}
+			log.Info("[JsonDB] Removed retired document %s", document)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Migrate upgrades every document that has pending migrations and writes them
+// back to disk, and deletes the documents in retired collections. It returns
+// the number of documents that were upgraded or deleted.
+func (db *DB) Migrate() (int, error) {
+	migrationsMu.RLock()
+	var collections []string
+	seen := map[string]bool{}
+	for _, m := range migrations {
+		if !seen[m.Collection] {
+			seen[m.Collection] = true
+			collections = append(collections, m.Collection)
+		}
+	}
+	migrationsMu.RUnlock()
+
+	var count int
+	for _, collection := range collections {
+		// A single document, or a collection of them?
+		var documents []string
+		if db.Exists(collection) {
+			documents = []string{collection}
+		} else {
+			documents, _ = db.List(collection)
+		}
+
+		for _, document := range documents {
+			migrated, err := db.migrateDocument(document)
+			if err != nil {
+				return count, err
+			}
+			if migrated {
+				log.Info("[JsonDB] Migrated %s", document)
+				count++
+			}
+		}
+	}
+
+	removed, err := db.RemoveRetired()
+	return count + removed, err
+}
+
+// migrateDocument upgrades a single document on disk.
+func (db *DB) migrateDocument(document string) (bool, error) {
+	defer db.beginWrite()()
+	unlock := db.lockWithIndexes(document)
+	defer unlock()
+
+	data, err := ioutil.ReadFile(db.toPath(document))
+	if err != nil {
+		return false, err
+	}
+
+	data, changed, err := migrateData(document, data)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	// Write it through a transaction so any secondary indexes keep up.
+	return true, db.applyLocked([]txOp{{Document: document, Data: data}})
+}
+
+// migrationsFor returns the migrations that apply to a document, in order.
+func migrationsFor(document string) []Migration {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+
+	var result []Migration
+	for _, m := range migrations {
+		if m.Collection == document || m.Collection == path.Dir(document) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// migrateData runs any pending migrations on the JSON of a document. It
+// returns the data unchanged (and false) if there was nothing to do.
+func migrateData(document string, data []byte) ([]byte, bool, error) {
+	pending := migrationsFor(document)
+	if len(pending) == 0 {
+		return data, false, nil
+	}
+
+	doc, ok := decodeObject(data)
+	if !ok {
+		return data, false, nil
+	}
+
+	var (
+		version = schemaVersion(doc)
+		changed bool
+	)
+	for _, m := range pending {
+		if m.Version <= version {
+			continue
+		}
+
+		if err := m.Migrate(doc); err != nil {
+			return nil, false, fmt.Errorf("migrating %s to schema version %d: %s", document, m.Version, err)
+		}
+		version = m.Version
+		changed = true
+	}
+
+	if !changed {
+		return data, false, nil
+	}
+
+	doc[SchemaKey] = version
+	data, err := encodeJSON(doc)
+	return data, true, err
+}
+
+// stampSchema records the latest schema version in a document's JSON, if its
+// collection has any migrations.
+func stampSchema(document string, data []byte) ([]byte, error) {
+	pending := migrationsFor(document)
+	if len(pending) == 0 {
+		return data, nil
+	}
+
+	doc, ok := decodeObject(data)
+	if !ok {
+		return data, nil
+	}
+
+	doc[SchemaKey] = pending[len(pending)-1].Version
+	return encodeJSON(doc)
+}
+
+// decodeObject decodes JSON into a generic object, keeping numbers exact.
+func decodeObject(data []byte) (map[string]interface{}, bool) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil || doc == nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+// schemaVersion reads the schema version stamped in a document.
+func schemaVersion(doc map[string]interface{}) int {
+	switch v := doc[SchemaKey].(type) {
+	case json.Number:
+		n, _ := v.Int64()
+		return int(n)
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package jsondb
+
+import (
+	"path"
+	"strconv"
+)
+
+// sequence is the stored form of an ID sequence.
+type sequence struct {
+	Value int `json:"value"`
+}
+
+// NextSequence returns the next number from a named sequence, such as for
+// assigning the ID of a new document. The sequence is persisted under
+// `_sequences/` and updated under its lock, so no two callers ever get the
+// same number and numbers aren't handed out again after a document is deleted.
+//
+// Sequences are named after the collection they number, i.e. "blog/posts".
+// The first time a sequence is used it starts after the highest numbered
+// document already in that collection.
+func (db *DB) NextSequence(name string) (int, error) {
+	seq := &sequence{}
+	err := db.Update(path.Join("_sequences", name), seq, func() error {
+		if seq.Value == 0 {
+			seq.Value = db.highestID(name)
+		}
+		seq.Value++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return seq.Value, nil
+}
+
+// highestID finds the highest numbered document name in a collection.
+func (db *DB) highestID(collection string) int {
+	var highest int
+
+	docs, err := db.List(collection)
+	if err != nil {
+		return 0
+	}
+
+	for _, doc := range docs {
+		id, err := strconv.Atoi(path.Base(doc))
+		if err != nil {
+			continue
+		}
+
+		if id > highest {
+			highest = id
+		}
+	}
+
+	return highest
+}
@@ -0,0 +1,22 @@
+package jsondb
+
+// Snapshot calls `fn` while keeping every writer out of the database, so that
+// it sees a coherent copy of all the documents on disk (i.e. for a backup).
+// Reads carry on as normal, and writes resume once `fn` returns.
+//
+// `fn` must not write to the database itself.
+func (db *DB) Snapshot(fn func() error) error {
+	db.writers.Lock()
+	defer db.writers.Unlock()
+	return fn()
+}
+
+// beginWrite waits for any Snapshot in progress and holds off new ones until
+// the write is done. It returns the function to call when it's finished.
+//
+// Only the public entry points that write call this, never their helpers,
+// since a nested call could deadlock against a waiting Snapshot.
+func (db *DB) beginWrite() func() {
+	db.writers.RLock()
+	return db.writers.RUnlock
+}
@@ -0,0 +1,352 @@
+package jsondb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// journalDir is the directory under the DB root that holds the journals of
+// in-flight transactions. Journal files have no .json suffix so they never
+// show up in List().
+const journalDir = ".journal"
+
+// Journal states.
+const (
+	txCommit   = "commit"   // apply the new documents
+	txRollback = "rollback" // restore the previous documents
+)
+
+// Tx stages a set of document writes and deletions which are applied to the
+// database all together, or not at all. See DB.Transaction.
+type Tx struct {
+	db     *DB
+	ops    []txOp
+	locked map[string]bool // documents locked by TransactionOn
+}
+
+// txOp is a single staged change in a transaction, along with the previous
+// state of the document so that it can be rolled back.
+type txOp struct {
+	Document string `json:"document"`
+	Delete   bool   `json:"delete,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+
+	// The document as it was before the transaction.
+	Existed  bool   `json:"existed"`
+	Previous []byte `json:"previous,omitempty"`
+}
+
+// journal is the on-disk record of a transaction.
+type journal struct {
+	State   string    `json:"state"`
+	Created time.Time `json:"created"`
+	Ops     []txOp    `json:"ops"`
+
+	path string // where the journal is written
+}
+
+// newJournal creates a journal for a transaction with a unique file name, so
+// that transactions on unrelated documents can run at the same time.
+func (db *DB) newJournal(ops []txOp) *journal {
+	now := time.Now().UTC()
+	return &journal{
+		State:   txCommit,
+		Created: now,
+		Ops:     ops,
+		path: filepath.Join(db.Root, journalDir,
+			fmt.Sprintf("%d-%d", now.UnixNano(), rand.Uint32()),
+		),
+	}
+}
+
+// Transaction runs the function `fn` and then applies every Commit and Delete
+// it staged on the Tx as a single unit. If `fn` returns an error, nothing is
+// written.
+//
+// Before any document is touched, the full set of changes is written to a
+// journal under the DB root. If the app dies part way through applying them,
+// the journal is replayed by New() the next time the database is opened.
+func (db *DB) Transaction(fn func(tx *Tx) error) error {
+	tx := &Tx{db: db}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	defer db.beginWrite()()
+	return db.apply(tx.ops)
+}
+
+// TransactionOn is like Transaction, but locks the named documents before
+// calling `fn`. That lets `fn` read them with tx.Get and be sure that nobody
+// changes them before its own changes are written, i.e. to add an entry to a
+// shared list without losing one that was added at the same time.
+//
+// The transaction may only change the documents that it named.
+func (db *DB) TransactionOn(documents []string, fn func(tx *Tx) error) error {
+	defer db.beginWrite()()
+	unlock := db.lockWithIndexes(documents...)
+	defer unlock()
+
+	tx := &Tx{
+		db:     db,
+		locked: map[string]bool{},
+	}
+	for _, document := range documents {
+		tx.locked[document] = true
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for _, op := range tx.ops {
+		if !tx.locked[op.Document] {
+			return fmt.Errorf("transaction changed %s without locking it", op.Document)
+		}
+	}
+	return db.applyLocked(tx.ops)
+}
+
+// Get loads the current copy of a document that was locked by TransactionOn.
+// Changes staged on the Tx aren't seen.
+func (tx *Tx) Get(document string, v interface{}) error {
+	if !tx.locked[document] {
+		return fmt.Errorf("transaction read %s without locking it", document)
+	}
+	return tx.db.get(document, v)
+}
+
+// Commit stages a JSON object to be written to the database.
+func (tx *Tx) Commit(document string, v interface{}) error {
+	data, err := encodeDocument(document, v)
+	if err != nil {
+		return fmt.Errorf("failed to encode document %s: %s", document, err)
+	}
+	tx.stage(txOp{
+		Document: document,
+		Data:     data,
+	})
+	return nil
+}
+
+// Delete stages a document to be removed from the database.
+func (tx *Tx) Delete(document string) {
+	tx.stage(txOp{
+		Document: document,
+		Delete:   true,
+	})
+}
+
+// stage adds an operation to the transaction. Staging the same document twice
+// replaces the earlier operation.
+func (tx *Tx) stage(op txOp) {
+	for i, existing := range tx.ops {
+		if existing.Document == op.Document {
+			tx.ops[i] = op
+			return
+		}
+	}
+	tx.ops = append(tx.ops, op)
+}
+
+// apply writes a set of staged operations through the journal, along with
+// any changes to secondary indexes that they cause.
+func (db *DB) apply(ops []txOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	unlock := db.lockWithIndexes(opDocuments(ops)...)
+	defer unlock()
+	return db.applyLocked(ops)
+}
+
+// opDocuments returns the names of the documents a set of operations change.
+func opDocuments(ops []txOp) []string {
+	var documents []string
+	for _, op := range ops {
+		documents = append(documents, op.Document)
+	}
+	return documents
+}
+
+// applyLocked is apply for a caller that already holds the locks on the
+// documents and their indexes, from lockWithIndexes.
+func (db *DB) applyLocked(ops []txOp) error {
+	if len(ops) == 0 {
+		return nil
+	}
+
+	// Update the indexes.
+	affected := indexesFor(opDocuments(ops))
+	if len(affected) > 0 {
+		indexOps, err := db.indexOps(ops, affected)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, indexOps...)
+	}
+
+	// Record the current state of every document for rollback.
+	for i := range ops {
+		path := db.toPath(ops[i].Document)
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			ops[i].Existed = true
+			ops[i].Previous = data
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// Write the journal. Once it's on disk the transaction is committed.
+	j := db.newJournal(ops)
+	if err := db.writeJournal(j); err != nil {
+		return fmt.Errorf("failed to write transaction journal: %s", err)
+	}
+
+	if err := db.replay(j); err != nil {
+		log.Error("[JsonDB] Transaction failed, rolling back: %s", err)
+
+		// Mark the journal for rollback before touching anything, so a
+		// crash from here on out still gets rolled back on startup.
+		j.State = txRollback
+		if err2 := db.writeJournal(j); err2 != nil {
+			log.Error("[JsonDB] Failed to update transaction journal: %s", err2)
+		}
+		if err2 := db.replay(j); err2 != nil {
+			log.Error("[JsonDB] Rollback failed; will retry on next startup: %s", err2)
+			return err
+		}
+		db.removeJournal(j)
+		return err
+	}
+
+	db.removeJournal(j)
+
+	// Refresh the cache.
+	for _, op := range ops {
+		if op.Delete {
+			db.DeleteCache(op.Document)
+			db.DeleteCache(op.Document + "_mtime")
+		} else {
+			db.SetCache(op.Document, string(op.Data), CacheTimeout)
+			db.SetCache(op.Document+"_mtime", time.Now().Format(time.RFC3339Nano), CacheTimeout)
+		}
+	}
+
+	return nil
+}
+
+// replay carries out a journal: writing the new documents for a commit, or
+// restoring the previous ones for a rollback. It is safe to replay the same
+// journal more than once.
+func (db *DB) replay(j *journal) error {
+	for _, op := range j.Ops {
+		var (
+			path   = db.toPath(op.Document)
+			remove bool
+			data   []byte
+		)
+
+		if j.State == txRollback {
+			remove = !op.Existed
+			data = op.Previous
+		} else {
+			remove = op.Delete
+			data = op.Data
+		}
+
+		if remove {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		if err := db.makePath(path); err != nil {
+			return err
+		}
+		if err := writeFile(path, data); err != nil {
+			return fmt.Errorf("failed to write %s: %s", op.Document, err)
+		}
+	}
+	return nil
+}
+
+// Recover finishes or rolls back any transactions that were interrupted by
+// the app exiting. New calls it when the database is opened.
+func (db *DB) Recover() {
+	files, err := ioutil.ReadDir(filepath.Join(db.Root, journalDir))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("[JsonDB] Can't read transaction journals: %s", err)
+		}
+		return
+	}
+
+	// The file names begin with a timestamp, so ReadDir's sorting replays
+	// them in the order they were started.
+	for _, file := range files {
+		// Skip over writeFile's temp files.
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		j := &journal{
+			path: filepath.Join(db.Root, journalDir, file.Name()),
+		}
+		data, err := ioutil.ReadFile(j.path)
+		if err != nil {
+			log.Error("[JsonDB] Can't read transaction journal %s: %s", j.path, err)
+			continue
+		}
+		if err := json.Unmarshal(data, j); err != nil {
+			// The journal is written atomically, so this shouldn't happen.
+			log.Error("[JsonDB] Transaction journal %s is corrupt, discarding: %s", j.path, err)
+			db.removeJournal(j)
+			continue
+		}
+
+		log.Warn("[JsonDB] Recovering interrupted transaction from %s (%s, %d documents)",
+			j.Created, j.State, len(j.Ops),
+		)
+		if err := db.replay(j); err != nil {
+			log.Error("[JsonDB] Transaction recovery failed: %s", err)
+			continue
+		}
+		db.removeJournal(j)
+
+		// Anything cached about these documents is suspect.
+		for _, op := range j.Ops {
+			db.DeleteCache(op.Document)
+			db.DeleteCache(op.Document + "_mtime")
+		}
+	}
+}
+
+// writeJournal atomically writes a transaction journal.
+func (db *DB) writeJournal(j *journal) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	return writeFile(j.path, data)
+}
+
+// removeJournal deletes a transaction journal once it's been carried out.
+func (db *DB) removeJournal(j *journal) {
+	err := os.Remove(j.path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("[JsonDB] Failed to remove transaction journal: %s", err)
+	}
+}
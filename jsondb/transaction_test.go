@@ -0,0 +1,63 @@
+package jsondb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTransactionRecovery(t *testing.T) {
+	root, err := ioutil.TempDir("", "jsondb-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	db := New(root)
+	if err := db.Commit("test/a", "before"); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	// Simulate the app dying after writing the journal of each kind.
+	tests := []struct {
+		State  string
+		Expect string
+	}{
+		{txCommit, "after"},
+		{txRollback, "before"},
+	}
+	for _, test := range tests {
+		before, _ := encodeJSON("before")
+		after, _ := encodeJSON("after")
+		j := db.newJournal([]txOp{
+			{Document: "test/a", Data: after, Existed: true, Previous: before},
+			{Document: "test/b", Data: after},
+		})
+		j.State = test.State
+		err := db.writeJournal(j)
+		if err != nil {
+			t.Fatalf("writeJournal: %s", err)
+		}
+
+		// Opening the database without recovery leaves it alone.
+		db = Open(root)
+		var a string
+		if err := db.Get("test/a", &a); err != nil || a != "before" {
+			t.Errorf("%s: Open recovered the transaction: test/a is %q (err: %v)", test.State, a, err)
+		}
+
+		// Reopening the database should recover the transaction.
+		db = New(root)
+
+		if err := db.Get("test/a", &a); err != nil || a != test.Expect {
+			t.Errorf("%s: expected test/a to be %q, got %q (err: %v)", test.State, test.Expect, a, err)
+		}
+		if db.Exists("test/b") != (test.State == txCommit) {
+			t.Errorf("%s: test/b existence is wrong", test.State)
+		}
+
+		// Reset for the next case.
+		db.Commit("test/a", "before")
+		db.Delete("test/b")
+	}
+}
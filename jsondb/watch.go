@@ -0,0 +1,133 @@
+package jsondb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch starts watching the database's files for changes made outside of
+// JsonDB, such as by hand-editing the JSON on the server, and removes the
+// changed documents from the cache right away.
+//
+// Once the watcher is running, Get trusts the cache without checking the
+// file's modification time on every read. If the watcher reports an error it
+// may have missed changes, so Get goes back to checking. Calling Watch again
+// while it's already running does nothing.
+func (db *DB) Watch() error {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	if db.watcher != nil {
+		return nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(db.Root, 0755); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	// fsnotify doesn't recurse, so every directory is watched separately.
+	if err := db.watchTree(watcher, db.Root); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	log.Info("[JsonDB] Watching %s for changes", db.Root)
+	db.watcher = watcher
+	go db.watchLoop(watcher)
+
+	// Only trust the cache once every directory is being watched.
+	atomic.StoreInt32(&db.watching, 1)
+	return nil
+}
+
+// Unwatch stops the file watcher started by Watch.
+func (db *DB) Unwatch() error {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	if db.watcher == nil {
+		return nil
+	}
+
+	atomic.StoreInt32(&db.watching, 0)
+	err := db.watcher.Close()
+	db.watcher = nil
+	return err
+}
+
+// isWatching returns whether the file watcher is running and can be trusted
+// to have evicted every changed document from the cache.
+func (db *DB) isWatching() bool {
+	return atomic.LoadInt32(&db.watching) == 1
+}
+
+// watchTree adds a directory and all of its subdirectories to the watcher.
+func (db *DB) watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+// watchLoop handles events from the file watcher until it's closed.
+func (db *DB) watchLoop(watcher *fsnotify.Watcher) {
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			// Start watching new directories as they're created.
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+					if err := db.watchTree(watcher, event.Name); err != nil {
+						log.Error("[JsonDB] Can't watch new directory %s: %s", event.Name, err)
+					}
+					continue
+				}
+			}
+
+			// Only documents are interesting; this also skips writeFile's
+			// temp files.
+			if !strings.HasSuffix(event.Name, ".json") {
+				continue
+			}
+
+			document, err := filepath.Rel(db.Root, strings.TrimSuffix(event.Name, ".json"))
+			if err != nil {
+				continue
+			}
+			document = filepath.ToSlash(document)
+
+			// Our own Commits land here too (as the temp file is renamed
+			// into place) which costs one extra read from disk; the
+			// alternative is risking a stale cache.
+			log.Debug("[JsonDB] %s: changed on disk (%s)", document, event.Op)
+			atomic.AddUint32(&db.evictions, 1)
+			db.DeleteCache(document)
+			db.DeleteCache(document + "_mtime")
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been lost (i.e. the queue overflowed), so
+			// stop trusting the cache; the watcher still evicts what it sees.
+			log.Error("[JsonDB] File watcher error, checking modification times again: %s", err)
+			atomic.StoreInt32(&db.watching, 0)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package jsondb_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapCache is a bare-bones caches.Cacher for tests.
+type mapCache struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (c *mapCache) Get(key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if v, ok := c.data[key]; ok {
+		return v, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (c *mapCache) Set(key string, v []byte, expires int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = v
+	return nil
+}
+
+func (c *mapCache) Delete(key ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range key {
+		delete(c.data, k)
+	}
+}
+
+func (c *mapCache) Keys(pattern string) ([]string, error)    { return nil, nil }
+func (c *mapCache) Lock(key, value string, expires int) bool { return true }
+func (c *mapCache) Unlock(key string)                        {}
+
+func TestWatch(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	cache := &mapCache{data: map[string][]byte{}}
+	db.WithCache(cache)
+
+	if err := db.Watch(); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	defer db.Unwatch()
+
+	if err := db.Commit("watched/doc", testDoc{"before", 1}); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	// Edit the file by hand, like an admin on the server would.
+	path := filepath.Join(db.Root, "watched", "doc.json")
+	time.Sleep(50 * time.Millisecond) // let the Commit's own events settle
+	db.Get("watched/doc", &testDoc{})
+	if err := ioutil.WriteFile(path, []byte(`{"name": "after", "count": 2}`), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+
+	// The watcher should evict the cached copy shortly.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		doc := testDoc{}
+		if err := db.Get("watched/doc", &doc); err != nil {
+			t.Fatalf("Get: %s", err)
+		}
+		if doc.Name == "after" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cached copy was never invalidated; got %+v", doc)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchConcurrently(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	// Starting and stopping the watcher from several goroutines at once must
+	// not race.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := db.Watch(); err != nil {
+				t.Errorf("Watch: %s", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := db.Unwatch(); err != nil {
+				t.Errorf("Unwatch: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	db.Unwatch()
+}
+
+// hookCache is a mapCache that runs a function before storing a key, and
+// reports the keys it deletes.
+type hookCache struct {
+	*mapCache
+	beforeSet func(key string)
+	deleted   chan string
+}
+
+func (c *hookCache) Set(key string, v []byte, expires int) error {
+	if c.beforeSet != nil {
+		c.beforeSet(key)
+	}
+	return c.mapCache.Set(key, v, expires)
+}
+
+func (c *hookCache) Delete(key ...string) {
+	c.mapCache.Delete(key...)
+	for _, k := range key {
+		select {
+		case c.deleted <- k:
+		default:
+		}
+	}
+}
+
+func TestWatchRacingRead(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+	cache := &hookCache{
+		mapCache: &mapCache{data: map[string][]byte{}},
+		deleted:  make(chan string, 100),
+	}
+	db.WithCache(cache)
+
+	if err := db.Watch(); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	defer db.Unwatch()
+
+	if err := db.Commit("watched/doc", testDoc{"before", 1}); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond) // let the Commit's own events settle
+	cache.mapCache.Delete("watched/doc", "watched/doc_mtime")
+	for len(cache.deleted) > 0 {
+		<-cache.deleted
+	}
+
+	// The file is edited after a Get has read it, and the watcher evicts the
+	// document before the Get caches what it read.
+	path := filepath.Join(db.Root, "watched", "doc.json")
+	var once sync.Once
+	cache.beforeSet = func(key string) {
+		if key != "watched/doc" {
+			return
+		}
+		once.Do(func() {
+			if err := ioutil.WriteFile(path, []byte(`{"name": "after", "count": 2}`), 0644); err != nil {
+				t.Fatalf("WriteFile: %s", err)
+			}
+			timeout := time.After(2 * time.Second)
+			for {
+				select {
+				case key := <-cache.deleted:
+					if key == "watched/doc" {
+						return
+					}
+				case <-timeout:
+					t.Fatal("the watcher never evicted the document")
+				}
+			}
+		})
+	}
+	if err := db.Get("watched/doc", &testDoc{}); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	cache.beforeSet = nil
+
+	// The copy it read mustn't be trusted in place of the edit.
+	doc := testDoc{}
+	if err := db.Get("watched/doc", &doc); err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if doc.Name != "after" {
+		t.Errorf("a stale copy was left in the cache: got %+v", doc)
+	}
+}
@@ -0,0 +1,134 @@
+package comments
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// BanListDBName is the path to the singleton list of banned commenters.
+const BanListDBName = "comments/banned"
+
+// BanList is the list of people who may no longer post comments, contact
+// messages or questions, by email address or by IP address.
+type BanList struct {
+	Emails map[string]bool `json:"emails"`
+	IPs    []string        `json:"ips,omitempty"`  // IP addresses or CIDR ranges
+	Hold   bool            `json:"hold,omitempty"` // hold their posts quietly instead of turning them away
+}
+
+// LoadBanList loads the ban list, or initializes it if it doesn't exist.
+func LoadBanList() *BanList {
+	b := &BanList{
+		Emails: map[string]bool{},
+	}
+	DB.Get(BanListDBName, &b)
+	return b
+}
+
+// Ban an email address from commenting.
+func (b *BanList) Ban(email string) error {
+	email = strings.ToLower(email)
+	return DB.Update(BanListDBName, b, func() error {
+		if b.Emails == nil {
+			b.Emails = map[string]bool{}
+		}
+		b.Emails[email] = true
+		return nil
+	})
+}
+
+// BanIP bans an IP address or CIDR range.
+func (b *BanList) BanIP(ip string) error {
+	if err := ValidateIP(ip); err != nil {
+		return err
+	}
+	return DB.Update(BanListDBName, b, func() error {
+		for _, existing := range b.IPs {
+			if existing == ip {
+				return nil
+			}
+		}
+		b.IPs = append(b.IPs, ip)
+		return nil
+	})
+}
+
+// Save replaces the ban list with new lists of emails and IPs.
+func (b *BanList) Save(emails, ips []string, hold bool) error {
+	for _, ip := range ips {
+		if err := ValidateIP(ip); err != nil {
+			return err
+		}
+	}
+
+	return DB.Update(BanListDBName, b, func() error {
+		b.Emails = map[string]bool{}
+		for _, email := range emails {
+			b.Emails[strings.ToLower(email)] = true
+		}
+		b.IPs = ips
+		b.Hold = hold
+		return nil
+	})
+}
+
+// EmailList returns the banned email addresses in order.
+func (b *BanList) EmailList() []string {
+	result := []string{}
+	for email := range b.Emails {
+		result = append(result, email)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// IsBanned returns whether an email address is banned from commenting.
+func (b *BanList) IsBanned(email string) bool {
+	return email != "" && b.Emails[strings.ToLower(email)]
+}
+
+// IsBannedIP returns whether an IP address is banned, by itself or as part of
+// a banned range.
+func (b *BanList) IsBannedIP(ip string) bool {
+	return InNetworks(ip, b.IPs)
+}
+
+// Blocks returns whether either the email address or the IP address of a
+// post is banned.
+func (b *BanList) Blocks(email, ip string) bool {
+	return b.IsBanned(email) || b.IsBannedIP(ip)
+}
+
+// InNetworks returns whether an IP address is one of the entries, which may be
+// IP addresses or CIDR ranges, as checked by ValidateIP. It's shared by the ban
+// list and the trusted proxies in the settings.
+func InNetworks(ip string, entries []string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, entry := range entries {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(entry); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateIP checks that a ban list entry is an IP address or CIDR range.
+func ValidateIP(entry string) error {
+	if net.ParseIP(entry) != nil {
+		return nil
+	}
+	if _, _, err := net.ParseCIDR(entry); err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s is not an IP address or CIDR range", entry)
+}
@@ -0,0 +1,71 @@
+package comments_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+)
+
+func TestBanList(t *testing.T) {
+	root, err := ioutil.TempDir("", "comments-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	comments.DB = jsondb.New(root)
+
+	bans := comments.LoadBanList()
+	if err := bans.Save([]string{"Spammer@example.com"}, []string{"203.0.113.0/24", "2001:db8::1"}, true); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	if err := bans.Save(nil, []string{"not an ip"}, false); err == nil {
+		t.Error("expected an error for a bad IP address")
+	}
+
+	bans = comments.LoadBanList()
+	if !bans.Hold {
+		t.Error("expected the ban list to hold posts")
+	}
+	var tests = []struct {
+		email  string
+		ip     string
+		expect bool
+	}{
+		{"spammer@EXAMPLE.com", "", true},
+		{"", "203.0.113.99", true},
+		{"", "2001:db8::1", true},
+		{"friend@example.com", "198.51.100.1", false},
+		{"", "2001:db8::2", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if got := bans.Blocks(test.email, test.ip); got != test.expect {
+			t.Errorf("Blocks(%q, %q): expected %v, got %v", test.email, test.ip, test.expect, got)
+		}
+	}
+
+	if err := bans.BanIP("198.51.100.1"); err != nil {
+		t.Fatalf("BanIP: %s", err)
+	}
+	if !comments.LoadBanList().IsBannedIP("198.51.100.1") {
+		t.Error("expected the new IP to be banned")
+	}
+
+	// The matching shared with the trusted proxies setting.
+	networks := []string{"10.0.0.0/8", "2001:db8::1", "not an ip"}
+	for ip, expect := range map[string]bool{
+		"10.1.2.3":    true,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+		"192.0.2.1":   false,
+		"not an ip":   false,
+		"":            false,
+	} {
+		if got := comments.InNetworks(ip, networks); got != expect {
+			t.Errorf("InNetworks(%q): expected %v, got %v", ip, expect, got)
+		}
+	}
+}
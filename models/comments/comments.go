@@ -8,6 +8,9 @@ import (
 	"io"
 	"net/http"
 	"net/mail"
+	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -27,6 +30,8 @@ func init() {
 // Thread contains a thread of comments, for a blog post or otherwise.
 type Thread struct {
 	ID       string     `json:"id"`
+	URL      string     `json:"url,omitempty"`     // page the thread appears on
+	Subject  string     `json:"subject,omitempty"` // title of that page
 	Comments []*Comment `json:"comments"`
 }
 
@@ -40,6 +45,11 @@ type Comment struct {
 	Body        string    `json:"body"`
 	EditToken   string    `json:"editToken"`
 	DeleteToken string    `json:"deleteToken"`
+	Status      string    `json:"status,omitempty"`   // StatusPending or StatusApproved
+	ParentID    string    `json:"parentId,omitempty"` // comment this one replies to
+	Deleted     bool      `json:"deleted,omitempty"`  // placeholder kept for its replies
+	IP          string    `json:"ip,omitempty"`
+	UserAgent   string    `json:"userAgent,omitempty"`
 	Created     time.Time `json:"created"`
 	Updated     time.Time `json:"updated"`
 
@@ -54,10 +64,13 @@ type Comment struct {
 	Trap2     string        `json:"-"`
 
 	// Even privater fields.
-	IsAuthenticated bool   `json:"-"`
-	Username        string `json:"-"`
-	Editable        bool   `json:"-"`
-	Editing         bool   `json:"-"`
+	IsAuthenticated bool       `json:"-"`
+	Username        string     `json:"-"`
+	Editable        bool       `json:"-"`
+	Editing         bool       `json:"-"`
+	CanReply        bool       `json:"-"`
+	Replies         []*Comment `json:"-"` // filled in by Thread.Tree
+	Depth           int        `json:"-"`
 }
 
 type ByCreated []*Comment
@@ -81,37 +94,81 @@ func Load(id string) (Thread, error) {
 	return t, err
 }
 
+// Recent returns the comments from every thread, newest first. Each has its
+// ThreadID, OriginURL and Subject filled in from its thread. Placeholders of
+// deleted comments are left out.
+func Recent() ([]*Comment, error) {
+	keys, err := DB.List("comments/threads")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Comment{}, nil
+		}
+		return nil, err
+	}
+
+	result := []*Comment{}
+	for _, key := range keys {
+		t := Thread{}
+		if err := DB.Get(key, &t); err != nil {
+			log.Error("comments.Recent: couldn't load %s: %s", key, err)
+			continue
+		}
+
+		for _, c := range t.Comments {
+			if c.Deleted {
+				continue
+			}
+			c.ThreadID = t.ID
+			c.OriginURL = t.URL
+			c.Subject = t.Subject
+			result = append(result, c)
+		}
+	}
+
+	sort.Sort(sort.Reverse(ByCreated(result)))
+	return result, nil
+}
+
+// DB key for the comment thread.
+func (t *Thread) key() string {
+	return fmt.Sprintf("comments/threads/%s", t.ID)
+}
+
 // Post a comment to a thread.
+//
+// The thread is reloaded from the database and updated under its lock, so
+// comments posted at the same time by others aren't lost.
 func (t *Thread) Post(c *Comment) error {
-	// If it has an ID, update an existing comment.
-	if len(c.ID) > 0 {
-		idx := -1
-		for i, comment := range t.Comments {
-			if comment.ID == c.ID {
-				idx = i
-				break
-			}
+	return DB.Update(t.key(), t, func() error {
+		// Remember where the thread lives, for the comments feed.
+		if strings.HasPrefix(c.OriginURL, "/") && !strings.HasPrefix(c.OriginURL, "//") {
+			t.URL = c.OriginURL
+		}
+		if c.Subject != "" {
+			t.Subject = c.Subject
 		}
 
-		// Replace the comment by index.
-		if idx >= 0 && idx < len(t.Comments) {
-			t.Comments[idx] = c
-			DB.Commit(fmt.Sprintf("comments/threads/%s", t.ID), t)
-			return nil
+		// If it has an ID, update an existing comment.
+		if len(c.ID) > 0 {
+			for i, comment := range t.Comments {
+				if comment.ID == c.ID {
+					t.Comments[i] = c
+					return nil
+				}
+			}
 		}
-	}
 
-	// Assign an ID.
-	if c.ID == "" {
-		c.ID = uuid.New().String()
-	}
-	if c.DeleteToken == "" {
-		c.DeleteToken = uuid.New().String()
-	}
+		// Assign an ID.
+		if c.ID == "" {
+			c.ID = uuid.New().String()
+		}
+		if c.DeleteToken == "" {
+			c.DeleteToken = uuid.New().String()
+		}
 
-	t.Comments = append(t.Comments, c)
-	DB.Commit(fmt.Sprintf("comments/threads/%s", t.ID), t)
-	return nil
+		t.Comments = append(t.Comments, c)
+		return nil
+	})
 }
 
 // Find a comment by its ID.
@@ -124,25 +181,67 @@ func (t *Thread) Find(id string) (*Comment, error) {
 	return nil, errors.New("comment not found")
 }
 
+// Edit the body of a comment by its ID.
+//
+// The comment is changed on the thread as it is in the database, under its
+// lock, so nothing else about the thread is overwritten with a stale copy.
+func (t *Thread) Edit(id, body string) error {
+	return DB.Update(t.key(), t, func() error {
+		c, err := t.Find(id)
+		if err != nil {
+			return err
+		}
+		c.Body = body
+		c.Updated = time.Now().UTC()
+		return nil
+	})
+}
+
 // Delete a comment by its ID.
+//
+// A comment with replies is replaced by a "[deleted]" placeholder so the
+// replies keep their place, and a placeholder goes away with its last reply.
 func (t *Thread) Delete(id string) error {
+	return DB.Update(t.key(), t, func() error {
+		c, err := t.Find(id)
+		if err != nil {
+			return err
+		}
+
+		if t.hasReplies(id) {
+			*c = Comment{
+				ID:       c.ID,
+				ParentID: c.ParentID,
+				Deleted:  true,
+				Created:  c.Created,
+				Updated:  time.Now().UTC(),
+			}
+			return nil
+		}
+
+		for c != nil {
+			t.remove(c.ID)
+
+			// Tidy up the placeholder it replied to, if that was its last reply.
+			parent, err := t.Find(c.ParentID)
+			if err != nil || !parent.Deleted || t.hasReplies(parent.ID) {
+				break
+			}
+			c = parent
+		}
+		return nil
+	})
+}
+
+// remove a comment from the thread without saving it.
+func (t *Thread) remove(id string) {
 	keep := []*Comment{}
-	var found bool
 	for _, c := range t.Comments {
 		if c.ID != id {
 			keep = append(keep, c)
-		} else {
-			found = true
 		}
 	}
-
-	if !found {
-		return errors.New("comment not found")
-	}
-
 	t.Comments = keep
-	DB.Commit(fmt.Sprintf("comments/threads/%s", t.ID), t)
-	return nil
 }
 
 // FindByDeleteToken finds a comment by its deletion token.
@@ -169,6 +268,7 @@ func (c *Comment) ParseForm(r *http.Request) {
 	define(&c.ThreadID, r.FormValue("thread"))
 	define(&c.OriginURL, r.FormValue("origin"))
 	define(&c.Subject, r.FormValue("subject"))
+	define(&c.ParentID, r.FormValue("parent"))
 
 	define(&c.Name, r.FormValue("name"))
 	define(&c.Email, r.FormValue("email"))
@@ -0,0 +1,175 @@
+package comments
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+)
+
+func init() {
+	// A secondary index on the comments in every thread, so the admin can
+	// search them without loading each thread. It's one index holding each
+	// comment's created time, name and email together, so posting a comment
+	// rewrites a single index document. Placeholders of deleted comments
+	// aren't indexed.
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "comments/threads",
+		Field:      "comments",
+		New:        func() interface{} { return &Thread{} },
+		Values: func(v interface{}) []string {
+			return v.(*Thread).indexValues()
+		},
+	})
+
+	// The separate indexes it replaced.
+	for _, field := range []string{"created", "name", "email"} {
+		jsondb.RetireCollection("_index/comments/threads/" + field)
+	}
+}
+
+// indexEntry is a comment's value in the index: the fields it's searched by,
+// with the name and email in lowercase.
+type indexEntry struct {
+	Created time.Time `json:"created"`
+	Name    string    `json:"name,omitempty"`
+	Email   string    `json:"email,omitempty"`
+	Pending bool      `json:"pending,omitempty"`
+}
+
+// indexValue encodes the comment's entry in the index.
+func (c *Comment) indexValue() string {
+	data, _ := json.Marshal(indexEntry{
+		Created: c.Created.UTC(),
+		Name:    strings.ToLower(c.Name),
+		Email:   strings.ToLower(c.Email),
+		Pending: c.IsPending(),
+	})
+	return string(data)
+}
+
+// indexValues returns the index entries of the comments in the thread.
+func (t *Thread) indexValues() []string {
+	var values []string
+	for _, c := range t.Comments {
+		if !c.Deleted {
+			values = append(values, c.indexValue())
+		}
+	}
+	return values
+}
+
+// Query narrows down a search of the comments from every thread. The zero
+// value matches them all.
+type Query struct {
+	ThreadID string
+	Name     string    // part of the commenter's name, in any case
+	Email    string    // part of their email address, in any case
+	After    time.Time // posted at or after this time
+	Before   time.Time // and before this one
+	Pending  bool      // only the comments waiting for a moderator
+}
+
+// Search returns the comments from every thread that match the query, newest
+// first, skipping the first `offset` of them and returning up to `limit` (or
+// all of them, if it's 0). It also returns whether there are more beyond
+// those.
+//
+// The comments are found through the index on "comments/threads", and only
+// the threads holding the page of results are loaded. Pending comments are
+// included; placeholders of deleted comments are not. Each comment has its
+// ThreadID, OriginURL and Subject filled in from its thread.
+func Search(q Query, offset, limit int) ([]*Comment, bool, error) {
+	entries, err := DB.IndexValues("comments/threads", "comments")
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Find the threads with matching comments, newest first.
+	type hit struct {
+		created  time.Time
+		value    string
+		document string
+	}
+	var hits []hit
+	for value, documents := range entries {
+		var entry indexEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil || !q.matchesEntry(entry) {
+			continue
+		}
+		for _, document := range documents {
+			if q.ThreadID == "" || document == "comments/threads/"+q.ThreadID {
+				hits = append(hits, hit{entry.Created, value, document})
+			}
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if !hits[i].created.Equal(hits[j].created) {
+			return hits[i].created.After(hits[j].created)
+		}
+		if hits[i].document != hits[j].document {
+			return hits[i].document < hits[j].document
+		}
+		return hits[i].value < hits[j].value
+	})
+
+	var (
+		result  = []*Comment{}
+		skipped int
+		threads = map[string]*Thread{}
+	)
+	for _, h := range hits {
+		t, ok := threads[h.document]
+		if !ok {
+			t = &Thread{}
+			if err := DB.Get(h.document, &t); err != nil {
+				log.Error("comments.Search: couldn't load %s: %s", h.document, err)
+				t = &Thread{}
+			}
+			threads[h.document] = t
+		}
+
+		for _, c := range t.Comments {
+			if c.Deleted || c.indexValue() != h.value {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+			if limit > 0 && len(result) == limit {
+				return result, true, nil
+			}
+
+			c.ThreadID = t.ID
+			c.OriginURL = t.URL
+			c.Subject = t.Subject
+			result = append(result, c)
+		}
+	}
+
+	return result, false, nil
+}
+
+// matchesEntry returns whether a comment's index entry matches the query's
+// name, email, date range and status.
+func (q Query) matchesEntry(e indexEntry) bool {
+	if q.Pending && !e.Pending {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(e.Name, strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.Email != "" && !strings.Contains(e.Email, strings.ToLower(q.Email)) {
+		return false
+	}
+	if !q.After.IsZero() && e.Created.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !e.Created.Before(q.Before) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,130 @@
+package comments_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+)
+
+func TestSearch(t *testing.T) {
+	root, err := ioutil.TempDir("", "comments-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	comments.DB = jsondb.New(root)
+
+	// Nothing to find in an empty database.
+	if result, more, err := comments.Search(comments.Query{}, 0, 10); err != nil || len(result) != 0 || more {
+		t.Fatalf("expected no comments yet, got %+v, %v (%v)", result, more, err)
+	}
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	post := func(thread, name, email string, day int) *comments.Comment {
+		th := comments.New(thread)
+		c := &comments.Comment{
+			Name:    name,
+			Email:   email,
+			Body:    "Hello from " + name,
+			Created: start.AddDate(0, 0, day),
+		}
+		if err := th.Post(c); err != nil {
+			t.Fatalf("Post: %s", err)
+		}
+		return c
+	}
+	post("post-1", "Alice", "alice@example.com", 0)
+	post("post-1", "Bob", "bob@example.com", 1)
+	post("post-2", "Alice", "Alice@Example.com", 2)
+	carol := post("post-2", "Carol", "carol@example.net", 3)
+	post("post-3", "Bob", "bob@example.com", 4)
+
+	names := func(q comments.Query, offset, limit int) ([]string, bool) {
+		result, more, err := comments.Search(q, offset, limit)
+		if err != nil {
+			t.Fatalf("Search(%+v): %s", q, err)
+		}
+		var names []string
+		for _, c := range result {
+			names = append(names, c.ThreadID+":"+c.Name)
+		}
+		return names, more
+	}
+	expect := func(label string, got []string, want ...string) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s: expected %v, got %v", label, want, got)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: expected %v, got %v", label, want, got)
+				return
+			}
+		}
+	}
+
+	got, more := names(comments.Query{}, 0, 2)
+	expect("first page", got, "post-3:Bob", "post-2:Carol")
+	if !more {
+		t.Error("expected more after the first page")
+	}
+	got, more = names(comments.Query{}, 4, 2)
+	expect("last page", got, "post-1:Alice")
+	if more {
+		t.Error("expected no more after the last page")
+	}
+
+	got, _ = names(comments.Query{ThreadID: "post-1"}, 0, 10)
+	expect("by thread", got, "post-1:Bob", "post-1:Alice")
+	got, _ = names(comments.Query{Name: "ALI"}, 0, 10)
+	expect("by name", got, "post-2:Alice", "post-1:Alice")
+	got, _ = names(comments.Query{Email: "example.net"}, 0, 10)
+	expect("by email", got, "post-2:Carol")
+	got, _ = names(comments.Query{Name: "bob", ThreadID: "post-3"}, 0, 10)
+	expect("by name and thread", got, "post-3:Bob")
+	got, _ = names(comments.Query{
+		After:  start.AddDate(0, 0, 1),
+		Before: start.AddDate(0, 0, 3),
+	}, 0, 10)
+	expect("by date", got, "post-2:Alice", "post-1:Bob")
+
+	// The indexes follow edits and deletions.
+	th, _ := comments.Load("post-2")
+	if err := th.Delete(carol.ID); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	got, _ = names(comments.Query{Email: "example.net"}, 0, 10)
+	expect("after deleting", got)
+
+	th, _ = comments.Load("post-3")
+	c := th.Comments[0]
+	c.Name = "Robert"
+	if err := th.Post(c); err != nil {
+		t.Fatalf("Post: %s", err)
+	}
+	got, _ = names(comments.Query{Name: "robert"}, 0, 10)
+	expect("after editing", got, "post-3:Robert")
+
+	// Editing a comment from a stale copy of its thread keeps the comments
+	// posted since.
+	stale, _ := comments.Load("post-1")
+	dave := post("post-1", "Dave", "dave@example.com", 5)
+	if err := stale.Edit(stale.Comments[0].ID, "Edited"); err != nil {
+		t.Fatalf("Edit: %s", err)
+	}
+	th, _ = comments.Load("post-1")
+	if _, err := th.Find(dave.ID); err != nil {
+		t.Error("the comment posted before the edit was lost")
+	}
+	if c, _ := th.Find(stale.Comments[0].ID); c == nil || c.Body != "Edited" {
+		t.Errorf("expected the comment to be edited, got %+v", c)
+	}
+	if err := stale.Edit("missing", "Edited"); err == nil {
+		t.Error("expected an error editing a missing comment")
+	}
+}
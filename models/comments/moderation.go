@@ -0,0 +1,84 @@
+package comments
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Comment moderation statuses. Comments from before moderation was added have
+// no status, and count as approved.
+const (
+	StatusApproved = "approved"
+	StatusPending  = "pending"
+)
+
+// IsPending returns whether the comment is waiting for a moderator.
+func (c *Comment) IsPending() bool {
+	return c.Status == StatusPending
+}
+
+// Approved returns the comments in the thread that everyone can see, not
+// counting the placeholders of deleted comments.
+func (t *Thread) Approved() []*Comment {
+	result := []*Comment{}
+	for _, c := range t.Comments {
+		if !c.IsPending() && !c.Deleted {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Approve a pending comment by its ID, returning it.
+func (t *Thread) Approve(id string) (*Comment, error) {
+	var approved *Comment
+	err := DB.Update(t.key(), t, func() error {
+		c, err := t.Find(id)
+		if err != nil {
+			return err
+		}
+		c.Status = StatusApproved
+		c.Updated = time.Now().UTC()
+		approved = c
+		return nil
+	})
+	return approved, err
+}
+
+// Pending returns the comments from every thread that are waiting for a
+// moderator, oldest first. Only the threads that have them are loaded.
+func Pending() ([]*Comment, error) {
+	result, _, err := Search(Query{Pending: true}, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(ByCreated(result))
+	return result, nil
+}
+
+// HasApproved returns whether anybody with this email address has had a
+// comment approved before, anywhere on the site. It goes by the comments
+// index, without loading any threads.
+func HasApproved(email string) (bool, error) {
+	if email == "" {
+		return false, nil
+	}
+
+	entries, err := DB.IndexValues("comments/threads", "comments")
+	if err != nil {
+		return false, err
+	}
+	email = strings.ToLower(email)
+	for value := range entries {
+		var entry indexEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		if entry.Email == email && !entry.Pending {
+			return true, nil
+		}
+	}
+	return false, nil
+}
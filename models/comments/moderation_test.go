@@ -0,0 +1,70 @@
+package comments_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+)
+
+func TestModeration(t *testing.T) {
+	root, err := ioutil.TempDir("", "comments-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	comments.DB = jsondb.New(root)
+
+	now := time.Now().UTC()
+	thread := comments.New("post-1")
+	for i, c := range []*comments.Comment{
+		{Name: "Old", Email: "old@example.com", Body: "From before moderation"},
+		{Name: "New", Email: "new@example.com", Body: "Hold me", Status: comments.StatusPending},
+		{Name: "Newer", Email: "NEW@example.com", Body: "Me too", Status: comments.StatusPending},
+	} {
+		c.Created = now.Add(time.Duration(i) * time.Minute)
+		if err := thread.Post(c); err != nil {
+			t.Fatalf("Post: %s", err)
+		}
+	}
+
+	if n := len(thread.Approved()); n != 1 {
+		t.Errorf("expected 1 approved comment, got %d", n)
+	}
+	pending, err := comments.Pending()
+	if err != nil || len(pending) != 2 || pending[0].Name != "New" || pending[0].ThreadID != "post-1" {
+		t.Fatalf("unexpected pending comments: %+v (%v)", pending, err)
+	}
+
+	for email, expect := range map[string]bool{"OLD@example.com": true, "new@example.com": false, "": false} {
+		if ok, _ := comments.HasApproved(email); ok != expect {
+			t.Errorf("HasApproved(%q): expected %v", email, expect)
+		}
+	}
+
+	if _, err := thread.Approve(pending[0].ID); err != nil {
+		t.Fatalf("Approve: %s", err)
+	}
+	reloaded, _ := comments.Load("post-1")
+	if n := len(reloaded.Approved()); n != 2 {
+		t.Errorf("expected 2 approved comments after approving one, got %d", n)
+	}
+	if ok, _ := comments.HasApproved("new@example.com"); !ok {
+		t.Error("expected new@example.com to have an approved comment now")
+	}
+	if pending, _ := comments.Pending(); len(pending) != 1 || pending[0].Name != "Newer" {
+		t.Errorf("expected only Newer to be pending after approving New, got %+v", pending)
+	}
+
+	bans := comments.LoadBanList()
+	if err := bans.Ban("Spam@Example.com"); err != nil {
+		t.Fatalf("Ban: %s", err)
+	}
+	bans = comments.LoadBanList()
+	if !bans.IsBanned("spam@example.com") || bans.IsBanned("new@example.com") || bans.IsBanned("") {
+		t.Errorf("unexpected ban list: %+v", bans.Emails)
+	}
+}
@@ -0,0 +1,102 @@
+package comments
+
+import "sort"
+
+// Tree arranges the thread's comments into replies under their parents,
+// oldest first, and returns the top-level comments. Each comment gets its
+// Replies and Depth (starting at 1) filled in.
+//
+// Replies nested deeper than maxDepth are shown at the deepest level, after
+// the comment they replied to. A reply whose parent isn't in the thread (for
+// example, one not shown to this reader) becomes a top-level comment, and
+// placeholders of deleted comments with nothing left under them are dropped.
+func (t *Thread) Tree(maxDepth int) []*Comment {
+	if maxDepth < 1 {
+		maxDepth = 1
+	}
+
+	sorted := make([]*Comment, len(t.Comments))
+	copy(sorted, t.Comments)
+	sort.Stable(ByCreated(sorted))
+
+	byID := map[string]*Comment{}
+	for _, c := range sorted {
+		c.Replies = nil
+		c.Depth = 0
+		byID[c.ID] = c
+	}
+
+	var roots []*Comment
+	for _, c := range sorted {
+		parent := byID[c.ParentID]
+		for parent != nil && parent.Depth >= maxDepth {
+			parent = byID[parent.ParentID]
+		}
+		if parent == nil || parent.Depth == 0 {
+			c.Depth = 1
+			roots = append(roots, c)
+			continue
+		}
+		c.Depth = parent.Depth + 1
+		parent.Replies = append(parent.Replies, c)
+	}
+
+	return prune(roots)
+}
+
+// prune drops the deleted placeholders with no replies left under them.
+func prune(comments []*Comment) []*Comment {
+	var result []*Comment
+	for _, c := range comments {
+		c.Replies = prune(c.Replies)
+		if c.Deleted && len(c.Replies) == 0 {
+			continue
+		}
+		result = append(result, c)
+	}
+	return result
+}
+
+// ReplyTo returns the ID of the comment that a reply to `parentID` should go
+// under, so it's nested no deeper than maxDepth. It's empty when the parent
+// doesn't exist or replies aren't nested at all.
+func (t *Thread) ReplyTo(parentID string, maxDepth int) string {
+	for parentID != "" {
+		depth := t.depth(parentID)
+		if depth == 0 {
+			return ""
+		} else if depth < maxDepth {
+			return parentID
+		}
+		parent, _ := t.Find(parentID)
+		parentID = parent.ParentID
+	}
+	return ""
+}
+
+// depth returns how deeply nested a comment is, starting at 1, or 0 if it
+// isn't in the thread.
+func (t *Thread) depth(id string) int {
+	var depth int
+	seen := map[string]bool{}
+	for id != "" && !seen[id] {
+		seen[id] = true
+		c, err := t.Find(id)
+		if err != nil {
+			break
+		}
+		depth++
+		id = c.ParentID
+	}
+	return depth
+}
+
+// hasReplies returns whether any comment in the thread replies to this one.
+func (t *Thread) hasReplies(id string) bool {
+	for _, c := range t.Comments {
+		if c.ParentID == id {
+			return true
+		}
+	}
+	return false
+}
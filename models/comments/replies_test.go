@@ -0,0 +1,83 @@
+package comments_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+)
+
+func TestReplies(t *testing.T) {
+	root, err := ioutil.TempDir("", "comments-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	comments.DB = jsondb.New(root)
+
+	// a
+	// └ b
+	//   └ c
+	//     └ d (nested too deep, so it goes beside c)
+	// e
+	now := time.Now().UTC()
+	thread := comments.New("post-1")
+	for i, c := range []*comments.Comment{
+		{ID: "a", Name: "A", Body: "first"},
+		{ID: "b", Name: "B", Body: "reply", ParentID: "a"},
+		{ID: "c", Name: "C", Body: "reply", ParentID: "b"},
+		{ID: "d", Name: "D", Body: "reply", ParentID: "c"},
+		{ID: "e", Name: "E", Body: "second"},
+	} {
+		c.Created = now.Add(time.Duration(i) * time.Minute)
+		if err := thread.Post(c); err != nil {
+			t.Fatalf("Post: %s", err)
+		}
+	}
+
+	roots := thread.Tree(3)
+	if len(roots) != 2 || roots[0].ID != "a" || roots[1].ID != "e" {
+		t.Fatalf("unexpected top-level comments: %+v", roots)
+	}
+	b := roots[0].Replies[0]
+	if b.ID != "b" || b.Depth != 2 || len(b.Replies) != 2 || b.Replies[1].ID != "d" || b.Replies[1].Depth != 3 {
+		t.Errorf("unexpected replies to b: %+v", b.Replies)
+	}
+	if flat := thread.Tree(1); len(flat) != 5 {
+		t.Errorf("expected 5 comments with replies turned off, got %d", len(flat))
+	}
+
+	for parent, expect := range map[string]string{"a": "a", "b": "b", "c": "b", "d": "b", "x": ""} {
+		if got := thread.ReplyTo(parent, 3); got != expect {
+			t.Errorf("ReplyTo(%q): expected %q, got %q", parent, expect, got)
+		}
+	}
+
+	// Deleting a comment with replies leaves a placeholder.
+	if err := thread.Delete("b"); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	b, err = thread.Find("b")
+	if err != nil || !b.Deleted || b.Body != "" || b.Name != "" || b.ParentID != "a" {
+		t.Fatalf("expected a placeholder for b, got %+v (%v)", b, err)
+	}
+	if n := len(thread.Approved()); n != 4 {
+		t.Errorf("expected 4 approved comments, got %d", n)
+	}
+
+	// And the placeholder goes away with its last reply.
+	for _, id := range []string{"c", "d"} {
+		if err := thread.Delete(id); err != nil {
+			t.Fatalf("Delete(%s): %s", id, err)
+		}
+	}
+	if _, err := thread.Find("b"); err == nil {
+		t.Error("expected the placeholder for b to be gone")
+	}
+	if len(thread.Comments) != 2 {
+		t.Errorf("expected 2 comments left, got %d", len(thread.Comments))
+	}
+}
@@ -1,10 +1,16 @@
 package comments
 
-import "strings"
+import (
+	"errors"
+	"strings"
+)
 
 // ListDBName is the path to the singleton mailing list manager.
 const ListDBName = "comments/mailing-list"
 
+// errNotSubscribed cancels a mailing list update that has nothing to change.
+var errNotSubscribed = errors.New("email is not subscribed")
+
 // MailingList manages subscription data for all comment threads.
 type MailingList struct {
 	Threads map[string]Subscription
@@ -27,9 +33,11 @@ func LoadMailingList() *MailingList {
 // Subscribe to a comment thread.
 func (m *MailingList) Subscribe(thread, email string) error {
 	email = strings.ToLower(email)
-	t := m.initThread(thread)
-	t.Emails[email] = true
-	return DB.Commit(ListDBName, &m)
+	return DB.Update(ListDBName, m, func() error {
+		t := m.initThread(thread)
+		t.Emails[email] = true
+		return nil
+	})
 }
 
 // List the subscribers for a thread.
@@ -46,30 +54,43 @@ func (m *MailingList) List(thread string) []string {
 // successful; false indicates the email was not subscribed.
 func (m *MailingList) Unsubscribe(thread, email string) bool {
 	email = strings.ToLower(email)
-	t := m.initThread(thread)
-	if _, ok := t.Emails[email]; ok {
+	err := DB.Update(ListDBName, m, func() error {
+		t := m.initThread(thread)
+		if _, ok := t.Emails[email]; !ok {
+			return errNotSubscribed
+		}
 		delete(t.Emails, email)
-		DB.Commit(ListDBName, &m)
-		return true
-	}
-	return false
+		return nil
+	})
+	return err == nil
 }
 
 // UnsubscribeAll removes the email from all mailing lists.
 func (m *MailingList) UnsubscribeAll(email string) bool {
 	var any bool
 	email = strings.ToLower(email)
-	for thread := range m.Threads {
-		if m.Unsubscribe(thread, email) {
-			any = true
+	DB.Update(ListDBName, m, func() error {
+		for _, t := range m.Threads {
+			if _, ok := t.Emails[email]; ok {
+				delete(t.Emails, email)
+				any = true
+			}
 		}
-	}
+
+		if !any {
+			return errNotSubscribed
+		}
+		return nil
+	})
 
 	return any
 }
 
 // initialize a thread structure.
 func (m *MailingList) initThread(thread string) Subscription {
+	if m.Threads == nil {
+		m.Threads = map[string]Subscription{}
+	}
 	if _, ok := m.Threads[thread]; !ok {
 		m.Threads[thread] = Subscription{
 			Emails: map[string]bool{},
@@ -0,0 +1,44 @@
+package posts
+
+import "sync"
+
+// Hooks that other parts of the app can register to hear about posts.
+var (
+	hooksMu      sync.RWMutex
+	publishHooks []func(p *Post)
+	changeHooks  []func(p *Post)
+)
+
+// OnPublish registers a function to call whenever a post goes public, whether
+// it was posted from the editor or published on schedule.
+func OnPublish(fn func(p *Post)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	publishHooks = append(publishHooks, fn)
+}
+
+// OnChange registers a function to call whenever a post is saved or deleted.
+func OnChange(fn func(p *Post)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	changeHooks = append(changeHooks, fn)
+}
+
+// published runs the publish hooks for a post.
+func published(p *Post) {
+	runHooks(&publishHooks, p)
+}
+
+// changed runs the change hooks for a post.
+func changed(p *Post) {
+	runHooks(&changeHooks, p)
+}
+
+// runHooks calls each of the hooks with the post.
+func runHooks(hooks *[]func(p *Post), p *Post) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, fn := range *hooks {
+		fn(p)
+	}
+}
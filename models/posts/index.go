@@ -1,22 +1,36 @@
 package posts
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"sort"
+	"strings"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/search"
 )
 
-// UpdateIndex updates a post's metadata in the blog index.
+// UpdateIndex updates a post's metadata in the blog index and the search
+// index.
 func UpdateIndex(p *Post) error {
 	idx, err := GetIndex()
 	if err != nil {
 		return err
 	}
-	return idx.Update(p)
+	if err := idx.Update(p); err != nil {
+		return err
+	}
+	return search.Update(p.searchDocument())
 }
 
 // Index caches high level metadata about the blog's contents for fast access.
+//
+// Lookups by URL fragment and by tag go through the JsonDB secondary indexes
+// on the "blog/posts" collection instead.
 type Index struct {
 	Posts      map[int]Post   `json:"posts"`
-	Fragments  map[string]int `json:"fragments"`
 	Thumbnails map[int]string `json:"thumbnails"`
 }
 
@@ -31,11 +45,30 @@ func GetIndex() (*Index, error) {
 	return idx, err
 }
 
+// lockedIndex loads the index in a transaction that has it locked. The index
+// should have been built beforehand with GetIndex, since rebuilding it reads
+// the posts that the transaction may have locked; if it still doesn't exist
+// there are no posts yet.
+func lockedIndex(tx *jsondb.Tx) (*Index, error) {
+	idx := &Index{}
+	err := tx.Get("blog/index", &idx)
+	if err != nil && err != jsondb.ErrNotFound {
+		return nil, fmt.Errorf("GetIndex error: %v", err)
+	}
+
+	if idx.Posts == nil {
+		idx.Posts = map[int]Post{}
+	}
+	if idx.Thumbnails == nil {
+		idx.Thumbnails = map[int]string{}
+	}
+	return idx, nil
+}
+
 // RebuildIndex builds the index from scratch.
 func RebuildIndex() (*Index, error) {
 	idx := &Index{
 		Posts:      map[int]Post{},
-		Fragments:  map[string]int{},
 		Thumbnails: map[int]string{},
 	}
 	entries, _ := DB.List("blog/posts")
@@ -54,6 +87,12 @@ func RebuildIndex() (*Index, error) {
 
 // Update a blog's entry in the index.
 func (idx *Index) Update(p *Post) error {
+	idx.update(p)
+	return DB.Commit("blog/index", idx)
+}
+
+// update a blog's entry in the index without saving it.
+func (idx *Index) update(p *Post) {
 	idx.Posts[p.ID] = Post{
 		ID:             p.ID,
 		Title:          p.Title,
@@ -63,27 +102,30 @@ func (idx *Index) Update(p *Post) error {
 		Sticky:         p.Sticky,
 		EnableComments: p.EnableComments,
 		Tags:           p.Tags,
+		WordCount:      p.WordCount,
+		PublishAt:      p.PublishAt,
 		Created:        p.Created,
 		Updated:        p.Updated,
 	}
-	idx.Fragments[p.Fragment] = p.ID
 
 	// Find a thumbnail image if possible.
 	if thumb, ok := p.ExtractThumbnail(); ok {
 		idx.Thumbnails[p.ID] = thumb
 	}
-
-	err := DB.Commit("blog/index", idx)
-	return err
 }
 
 // Delete a blog's entry from the index.
 func (idx *Index) Delete(p *Post) error {
-	delete(idx.Posts, p.ID)
-	delete(idx.Fragments, p.Fragment)
+	idx.remove(p)
 	return DB.Commit("blog/index", idx)
 }
 
+// remove a blog's entry from the index without saving it.
+func (idx *Index) remove(p *Post) {
+	delete(idx.Posts, p.ID)
+	delete(idx.Thumbnails, p.ID)
+}
+
 // Tag is a response from Tags including metadata about it.
 type Tag struct {
 	Name  string
@@ -110,30 +152,50 @@ func (s ByPopularity) Less(i, j int) bool {
 
 // Tags returns the tags sorted by most frequent.
 func (idx *Index) Tags() ([]Tag, error) {
-	idx, err := GetIndex()
+	byTag, err := DB.IndexValues("blog/posts", "tags")
 	if err != nil {
 		return nil, err
 	}
 
-	unique := map[string]*Tag{}
-
-	for _, post := range idx.Posts {
-		for _, name := range post.Tags {
-			tag, ok := unique[name]
-			if !ok {
-				tag = &Tag{name, 0}
-				unique[name] = tag
-			}
-			tag.Count++
-		}
-	}
-
 	// Sort the tags.
 	tags := []Tag{}
-	for _, tag := range unique {
-		tags = append(tags, *tag)
+	for name, docs := range byTag {
+		tags = append(tags, Tag{name, len(docs)})
 	}
 	sort.Sort(sort.Reverse(ByPopularity(tags)))
 
 	return tags, nil
 }
+
+// LastModified returns the newest Updated time of any post in the index.
+func (idx *Index) LastModified() time.Time {
+	var newest time.Time
+	for _, p := range idx.Posts {
+		if p.Updated.After(newest) {
+			newest = p.Updated
+		}
+	}
+	return newest
+}
+
+// Fingerprint returns a hash of everything in the index, which changes
+// whenever any post is added, edited or deleted.
+func (idx *Index) Fingerprint() string {
+	ids := make([]int, 0, len(idx.Posts))
+	for id := range idx.Posts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	h := sha1.New()
+	for _, id := range ids {
+		p := idx.Posts[id]
+		fmt.Fprintf(h, "%d\t%s\t%s\t%s\t%t\t%s\t%s\t%s\n",
+			p.ID, p.Title, p.Fragment, p.Privacy, p.Sticky,
+			strings.Join(p.Tags, ","),
+			p.Created.Format(time.RFC3339Nano),
+			p.Updated.Format(time.RFC3339Nano),
+		)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
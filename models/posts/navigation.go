@@ -0,0 +1,85 @@
+package posts
+
+import "sort"
+
+// Neighbors finds the posts created just before and just after the post with
+// the given ID, among those that `visible` allows. Either may be nil at the
+// ends of the blog.
+func (idx *Index) Neighbors(id int, visible func(Post) bool) (previous, next *Post) {
+	current, ok := idx.Posts[id]
+	if !ok {
+		return nil, nil
+	}
+
+	pool := ByCreated{current}
+	for _, post := range idx.Posts {
+		if post.ID != id && visible(post) {
+			pool = append(pool, post)
+		}
+	}
+	sort.Sort(pool)
+
+	for i, post := range pool {
+		if post.ID != id {
+			continue
+		}
+		if i > 0 {
+			previous = &pool[i-1]
+		}
+		if i < len(pool)-1 {
+			next = &pool[i+1]
+		}
+		break
+	}
+
+	return previous, next
+}
+
+// Related finds up to `limit` posts that share tags with the post with the
+// given ID, among those that `visible` allows. Posts sharing the most tags
+// come first, and the newest of those break ties.
+func (idx *Index) Related(id, limit int, visible func(Post) bool) []Post {
+	current, ok := idx.Posts[id]
+	if !ok || len(current.Tags) == 0 {
+		return nil
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range current.Tags {
+		tags[tag] = true
+	}
+
+	var (
+		pool   []Post
+		shared = map[int]int{}
+	)
+	for _, post := range idx.Posts {
+		if post.ID == id || !visible(post) {
+			continue
+		}
+		for _, tag := range post.Tags {
+			if tags[tag] {
+				shared[post.ID]++
+			}
+		}
+		if shared[post.ID] > 0 {
+			pool = append(pool, post)
+		}
+	}
+
+	sort.Slice(pool, func(i, j int) bool {
+		a, b := pool[i], pool[j]
+		if shared[a.ID] != shared[b.ID] {
+			return shared[a.ID] > shared[b.ID]
+		}
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+		return a.ID > b.ID
+	})
+
+	if len(pool) > limit {
+		pool = pool[:limit]
+	}
+	return pool
+}
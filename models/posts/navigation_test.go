@@ -0,0 +1,57 @@
+package posts_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/models/posts"
+)
+
+func TestNavigation(t *testing.T) {
+	day := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	idx := &posts.Index{
+		Posts: map[int]posts.Post{
+			1: {ID: 1, Privacy: "public", Tags: []string{"go"}, Created: day},
+			2: {ID: 2, Privacy: "draft", Tags: []string{"go", "web"}, Created: day.AddDate(0, 0, 1)},
+			3: {ID: 3, Privacy: "public", Tags: []string{"go", "web"}, Created: day.AddDate(0, 0, 2)},
+			4: {ID: 4, Privacy: "public", Tags: []string{"go", "web"}, Created: day.AddDate(0, 0, 3)},
+			5: {ID: 5, Privacy: "public", Tags: []string{"cats"}, Created: day.AddDate(0, 0, 4)},
+		},
+	}
+	public := func(p posts.Post) bool {
+		return p.Privacy == "public"
+	}
+
+	var tests = []struct {
+		id             int
+		previous, next int
+	}{
+		{1, 0, 3},
+		{2, 1, 3}, // a draft still has neighbours when viewed
+		{3, 1, 4},
+		{5, 4, 0},
+	}
+	for _, test := range tests {
+		previous, next := idx.Neighbors(test.id, public)
+		if id(previous) != test.previous || id(next) != test.next {
+			t.Errorf("Neighbors(%d): expected %d, %d; got %d, %d",
+				test.id, test.previous, test.next, id(previous), id(next))
+		}
+	}
+
+	related := idx.Related(3, 5, public)
+	if len(related) != 2 || related[0].ID != 4 || related[1].ID != 1 {
+		t.Errorf("Related(3): unexpected result %+v", related)
+	}
+	if related := idx.Related(5, 5, public); len(related) != 0 {
+		t.Errorf("Related(5): expected nothing, got %+v", related)
+	}
+}
+
+// id returns a post's ID, or 0 for no post.
+func id(p *posts.Post) int {
+	if p == nil {
+		return 0
+	}
+	return p.ID
+}
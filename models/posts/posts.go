@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/search"
 	"github.com/kirsle/golog"
 )
 
@@ -26,6 +27,30 @@ var (
 
 func init() {
 	log = golog.GetLogger("blog")
+
+	// Secondary indexes on the blog posts.
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "blog/posts",
+		Field:      "fragment",
+		New:        func() interface{} { return &Post{} },
+		Values: func(v interface{}) []string {
+			return []string{v.(*Post).Fragment}
+		},
+	})
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "blog/posts",
+		Field:      "tags",
+		New:        func() interface{} { return &Post{} },
+		Values: func(v interface{}) []string {
+			var tags []string
+			for _, tag := range v.(*Post).Tags {
+				if tag != "" {
+					tags = append(tags, tag)
+				}
+			}
+			return tags
+		},
+	})
 }
 
 // Post holds information for a blog post.
@@ -40,6 +65,8 @@ type Post struct {
 	Sticky         bool      `json:"sticky"`
 	EnableComments bool      `json:"enableComments"`
 	Tags           []string  `json:"tags"`
+	WordCount      int       `json:"wordCount"`
+	PublishAt      time.Time `json:"publishAt"` // when a scheduled post goes public
 	Created        time.Time `json:"created"`
 	Updated        time.Time `json:"updated"`
 }
@@ -66,6 +93,15 @@ func (p *Post) ParseForm(r *http.Request) {
 	p.Sticky = r.FormValue("sticky") == "true"
 	p.EnableComments = r.FormValue("enable-comments") == "true"
 
+	// The publish time only means anything for scheduled posts. The form
+	// gives it in the server's local time zone.
+	p.PublishAt = time.Time{}
+	if p.IsScheduled() {
+		if t, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue("publish-at"), time.Local); err == nil {
+			p.PublishAt = t.UTC()
+		}
+	}
+
 	// Ingest the tags.
 	tags := strings.Split(r.FormValue("tags"), ",")
 	p.Tags = []string{}
@@ -83,9 +119,13 @@ func (p *Post) Validate() error {
 		p.ContentType != "html" {
 		return errors.New("invalid setting for ContentType")
 	}
-	if p.Privacy != "public" && p.Privacy != "draft" && p.Privacy != "private" && p.Privacy != "unlisted" {
+	if p.Privacy != "public" && p.Privacy != "draft" && p.Privacy != "private" && p.Privacy != "unlisted" &&
+		p.Privacy != "scheduled" {
 		return errors.New("invalid setting for Privacy")
 	}
+	if p.IsScheduled() && p.PublishAt.IsZero() {
+		return errors.New("scheduled posts need a time to publish at")
+	}
 	return nil
 }
 
@@ -98,13 +138,15 @@ func Load(id int) (*Post, error) {
 
 // LoadFragment loads a blog entry by its URL fragment.
 func LoadFragment(fragment string) (*Post, error) {
-	idx, err := GetIndex()
+	docs, err := DB.FindBy("blog/posts", "fragment", fragment)
 	if err != nil {
 		return nil, err
 	}
 
-	if postID, ok := idx.Fragments[fragment]; ok {
-		return Load(postID)
+	if len(docs) > 0 {
+		p := &Post{}
+		err := DB.Get(docs[0], &p)
+		return p, err
 	}
 
 	return nil, errors.New("no such fragment found")
@@ -114,17 +156,16 @@ func LoadFragment(fragment string) (*Post, error) {
 func (p *Post) Save() error {
 	// Editing an existing post?
 	if p.ID == 0 {
-		p.ID = p.nextID()
+		id, err := DB.NextSequence("blog/posts")
+		if err != nil {
+			return fmt.Errorf("failed to assign a post ID: %v", err)
+		}
+		p.ID = id
 	}
 
 	// Generate a URL fragment if needed.
 	if p.Fragment == "" {
-		fragment := strings.ToLower(p.Title)
-		fragment = regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(fragment, "-")
-		if strings.Contains(fragment, "--") {
-			log.Error("Generated blog fragment '%s' contains double dashes still!", fragment)
-		}
-		p.Fragment = strings.Trim(fragment, "-")
+		p.Fragment = makeFragment(p.Title)
 
 		// If still no fragment, make one based on the post ID.
 		if p.Fragment == "" {
@@ -167,15 +208,53 @@ func (p *Post) Save() error {
 		p.Tags = []string{}
 	}
 
-	// Write the post.
-	DB.Commit(fmt.Sprintf("blog/posts/%d", p.ID), p)
+	p.WordCount = CountWords(p.Body)
+
+	// Write the post and its entry in the index together. The index is read
+	// inside the transaction so that posts saved at the same time don't drop
+	// each other's entries.
+	if _, err := GetIndex(); err != nil {
+		return fmt.Errorf("GetIndex error: %v", err)
+	}
+	var (
+		document = fmt.Sprintf("blog/posts/%d", p.ID)
+		rev      = newRevision(p) // keep a copy in the revision history
+		previous Post
+		existed  bool
+	)
+	err := DB.TransactionOn([]string{document, rev.key(), "blog/index"}, func(tx *jsondb.Tx) error {
+		idx, err := lockedIndex(tx)
+		if err != nil {
+			return err
+		}
+		previous, existed = idx.Posts[p.ID]
 
-	// Update the index cache.
-	err := UpdateIndex(p)
+		if err := tx.Commit(document, p); err != nil {
+			return err
+		}
+		if err := tx.Commit(rev.key(), rev); err != nil {
+			return err
+		}
+
+		idx.update(p)
+		return tx.Commit("blog/index", idx)
+	})
 	if err != nil {
-		return fmt.Errorf("RebuildIndex() error: %v", err)
+		return err
+	}
+
+	// Keep the search index up to date. The post itself is saved, so this
+	// isn't fatal; the index can be rebuilt.
+	if err := search.Update(p.searchDocument()); err != nil {
+		log.Error("Couldn't update the search index for post %d: %s", p.ID, err)
 	}
 
+	changed(p)
+
+	// Going public for the first time?
+	if p.Privacy == "public" && (!existed || previous.Privacy != "public") {
+		published(p)
+	}
 	return nil
 }
 
@@ -185,50 +264,102 @@ func (p *Post) Delete() error {
 		return errors.New("post has no ID")
 	}
 
-	// Delete the DB files.
-	DB.Delete(fmt.Sprintf("blog/posts/%d", p.ID))
-	DB.Delete(fmt.Sprintf("blog/fragments/%s", p.Fragment))
+	if _, err := GetIndex(); err != nil {
+		return fmt.Errorf("GetIndex error: %v", err)
+	}
 
-	// Remove it from the index.
-	idx, err := GetIndex()
+	// Delete the DB files and remove it from the index together.
+	revisions, _ := DB.List(revisionsPath(p.ID))
+	documents := append([]string{
+		fmt.Sprintf("blog/posts/%d", p.ID),
+		"blog/index",
+	}, revisions...)
+	err := DB.TransactionOn(documents, func(tx *jsondb.Tx) error {
+		idx, err := lockedIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range documents {
+			if doc != "blog/index" {
+				tx.Delete(doc)
+			}
+		}
+
+		idx.remove(p)
+		return tx.Commit("blog/index", idx)
+	})
 	if err != nil {
-		return fmt.Errorf("GetIndex error: %v", err)
+		return err
+	}
+
+	if err := search.Remove(p.searchKey()); err != nil {
+		log.Error("Couldn't remove post %d from the search index: %s", p.ID, err)
 	}
-	return idx.Delete(p)
+	if err := SetSeries(p.ID, 0, 0); err != nil {
+		log.Error("Couldn't remove post %d from its series: %s", p.ID, err)
+	}
+
+	changed(p)
+	return nil
 }
 
-// ExtractThumbnail searches and returns a thumbnail image to represent the
-// post. This will be the first image embedded in the post, or nothing.
-func (p *Post) ExtractThumbnail() (string, bool) {
-	result := ThumbnailImageRegexp.FindStringSubmatch(p.Body)
-	if len(result) < 2 {
-		return "", false
+// makeFragment turns a title into a URL fragment.
+func makeFragment(title string) string {
+	fragment := strings.ToLower(title)
+	fragment = regexp.MustCompile(`[^A-Za-z0-9]+`).ReplaceAllString(fragment, "-")
+	if strings.Contains(fragment, "--") {
+		log.Error("Generated blog fragment '%s' contains double dashes still!", fragment)
 	}
-	return result[1], true
+	return strings.Trim(fragment, "-")
 }
 
-// getNextID gets the next blog post ID.
-func (p *Post) nextID() int {
-	// Highest ID seen so far.
-	var highest int
+// searchKey is the post's key in the search index.
+func (p *Post) searchKey() string {
+	return fmt.Sprintf("post/%d", p.ID)
+}
 
-	posts, err := DB.List("blog/posts")
+// searchDocument returns the post as a document for the search index.
+func (p *Post) searchDocument() search.Document {
+	return search.Document{
+		Entry: search.Entry{
+			Key:     p.searchKey(),
+			Kind:    search.KindPost,
+			Title:   p.Title,
+			URL:     "/" + p.Fragment,
+			Privacy: p.Privacy,
+			Tags:    p.Tags,
+			Date:    p.Created,
+		},
+		Text: p.Body,
+	}
+}
+
+// SearchDocuments returns every blog post as a document for the search index,
+// to rebuild it from scratch.
+func SearchDocuments() ([]search.Document, error) {
+	idx, err := GetIndex()
 	if err != nil {
-		return 1
+		return nil, err
 	}
 
-	for _, doc := range posts {
-		fields := strings.Split(doc, "/")
-		id, err := strconv.Atoi(fields[len(fields)-1])
+	var docs []search.Document
+	for id := range idx.Posts {
+		p, err := Load(id)
 		if err != nil {
-			continue
-		}
-
-		if id > highest {
-			highest = id
+			return nil, err
 		}
+		docs = append(docs, p.searchDocument())
 	}
+	return docs, nil
+}
 
-	// Return the highest +1
-	return highest + 1
+// ExtractThumbnail searches and returns a thumbnail image to represent the
+// post. This will be the first image embedded in the post, or nothing.
+func (p *Post) ExtractThumbnail() (string, bool) {
+	result := ThumbnailImageRegexp.FindStringSubmatch(p.Body)
+	if len(result) < 2 {
+		return "", false
+	}
+	return result[1], true
 }
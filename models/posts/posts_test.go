@@ -0,0 +1,75 @@
+package posts_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
+)
+
+func TestSaveConcurrently(t *testing.T) {
+	root, err := ioutil.TempDir("", "posts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	posts.DB = jsondb.New(root)
+	search.DB = posts.DB
+
+	// Posts saved and deleted at the same time mustn't lose each other's
+	// entries in the blog index.
+	const count = 20
+	saved := make([]*posts.Post, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := &posts.Post{
+				Title:       fmt.Sprintf("Post %d", i),
+				Fragment:    fmt.Sprintf("post-%d", i),
+				ContentType: "markdown",
+				Privacy:     "private",
+			}
+			if err := p.Save(); err != nil {
+				t.Errorf("Save: %s", err)
+			}
+			saved[i] = p
+		}(i)
+	}
+	wg.Wait()
+
+	idx, err := posts.GetIndex()
+	if err != nil {
+		t.Fatalf("GetIndex: %s", err)
+	}
+	if len(idx.Posts) != count {
+		t.Fatalf("expected %d posts in the index, got %d", count, len(idx.Posts))
+	}
+
+	for i := 0; i < count; i += 2 {
+		wg.Add(1)
+		go func(p *posts.Post) {
+			defer wg.Done()
+			if err := p.Delete(); err != nil {
+				t.Errorf("Delete: %s", err)
+			}
+		}(saved[i])
+	}
+	wg.Wait()
+
+	idx, _ = posts.GetIndex()
+	if len(idx.Posts) != count/2 {
+		t.Errorf("expected %d posts in the index after deleting half, got %d", count/2, len(idx.Posts))
+	}
+	for i, p := range saved {
+		if _, ok := idx.Posts[p.ID]; ok != (i%2 == 1) {
+			t.Errorf("post %d: in the index = %v", p.ID, ok)
+		}
+	}
+}
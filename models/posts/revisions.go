@@ -0,0 +1,100 @@
+package posts
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+)
+
+// Revision is a copy of a blog post as it was saved at one point in time.
+//
+// Every Save keeps one under `blog/revisions/<post ID>/<timestamp>`, so a bad
+// edit can always be undone.
+type Revision struct {
+	ID       string    `json:"id"` // the timestamp, as used in its document name
+	PostID   int       `json:"postId"`
+	AuthorID int       `json:"author"` // who saved this revision
+	Created  time.Time `json:"created"`
+	Post     Post      `json:"post"`
+}
+
+// revisionIDFormat names revisions by their time, so they sort in order.
+const revisionIDFormat = "20060102-150405.000000000"
+
+// newRevision makes a revision of a post as it's being saved.
+func newRevision(p *Post) *Revision {
+	now := time.Now().UTC()
+	return &Revision{
+		ID:       now.Format(revisionIDFormat),
+		PostID:   p.ID,
+		AuthorID: p.AuthorID,
+		Created:  now,
+		Post:     *p,
+	}
+}
+
+// revisionsPath returns the JsonDB path holding a post's revisions.
+func revisionsPath(postID int) string {
+	return fmt.Sprintf("blog/revisions/%d", postID)
+}
+
+// key returns the revision's document name.
+func (rev *Revision) key() string {
+	return path.Join(revisionsPath(rev.PostID), rev.ID)
+}
+
+// Revisions returns every saved revision of a post, newest first.
+func Revisions(postID int) ([]*Revision, error) {
+	docs, err := DB.List(revisionsPath(postID))
+	if err != nil {
+		// No revisions saved yet.
+		return []*Revision{}, nil
+	}
+
+	result := []*Revision{}
+	for _, doc := range docs {
+		rev := &Revision{}
+		if err := DB.Get(doc, &rev); err != nil {
+			return nil, err
+		}
+		result = append(result, rev)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID > result[j].ID
+	})
+	return result, nil
+}
+
+// LoadRevision loads one revision of a post.
+func LoadRevision(postID int, id string) (*Revision, error) {
+	rev := &Revision{PostID: postID, ID: id}
+	if path.Base(id) != id || id == "" || id == "." || id == ".." {
+		return nil, jsondb.ErrNotFound
+	}
+
+	err := DB.Get(rev.key(), &rev)
+	return rev, err
+}
+
+// Restore saves the post as it was in this revision, by `authorID`. The post
+// keeps its current ID, and the restore is itself recorded as a new revision.
+func (rev *Revision) Restore(authorID int) (*Post, error) {
+	p := rev.Post
+	p.ID = rev.PostID
+	p.AuthorID = authorID
+	p.Updated = time.Now().UTC()
+
+	// A scheduled time that has passed would publish it straight away.
+	if p.IsScheduled() && p.PublishAt.Before(p.Updated) {
+		p.Privacy = "draft"
+	}
+
+	if err := p.Save(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
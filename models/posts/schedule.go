@@ -0,0 +1,63 @@
+package posts
+
+import (
+	"sync"
+	"time"
+)
+
+var schedulerOnce sync.Once
+
+// IsScheduled returns whether the post is waiting to be published at its
+// PublishAt time. Until then it's treated like a draft.
+func (p Post) IsScheduled() bool {
+	return p.Privacy == "scheduled"
+}
+
+// PublishScheduled makes every scheduled post whose time has come public, and
+// returns the posts that were published.
+func PublishScheduled(now time.Time) ([]*Post, error) {
+	idx, err := GetIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Post
+	for _, entry := range idx.Posts {
+		if !entry.IsScheduled() || entry.PublishAt.After(now) {
+			continue
+		}
+
+		p, err := Load(entry.ID)
+		if err != nil {
+			return result, err
+		}
+
+		// The post is dated from when it went live, not when it was written.
+		p.Privacy = "public"
+		p.Created = p.PublishAt
+		p.Updated = p.PublishAt
+		if err := p.Save(); err != nil {
+			return result, err
+		}
+
+		log.Info("Published scheduled blog post %d: %s", p.ID, p.Title)
+		result = append(result, p)
+	}
+
+	return result, nil
+}
+
+// StartScheduler checks for scheduled posts to publish every `interval` in the
+// background. Calling it again does nothing.
+func StartScheduler(interval time.Duration) {
+	schedulerOnce.Do(func() {
+		go func() {
+			for {
+				if _, err := PublishScheduled(time.Now().UTC()); err != nil {
+					log.Error("Error publishing scheduled posts: %s", err)
+				}
+				time.Sleep(interval)
+			}
+		}()
+	})
+}
@@ -0,0 +1,70 @@
+package posts_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
+)
+
+func TestPublishScheduled(t *testing.T) {
+	root, err := ioutil.TempDir("", "posts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	posts.DB = jsondb.New(root)
+	search.DB = posts.DB
+
+	var notified []string
+	posts.OnPublish(func(p *posts.Post) {
+		notified = append(notified, p.Title)
+	})
+
+	now := time.Now().UTC()
+	for _, p := range []*posts.Post{
+		{Title: "Public", Privacy: "public"},
+		{Title: "Due", Privacy: "scheduled", PublishAt: now.Add(-time.Minute)},
+		{Title: "Later", Privacy: "scheduled", PublishAt: now.Add(time.Hour)},
+	} {
+		p.ContentType = "markdown"
+		if err := p.Validate(); err != nil {
+			t.Fatalf("Validate(%s): %s", p.Title, err)
+		}
+		if err := p.Save(); err != nil {
+			t.Fatalf("Save(%s): %s", p.Title, err)
+		}
+	}
+
+	// Only the normal publish has fired so far.
+	if len(notified) != 1 || notified[0] != "Public" {
+		t.Errorf("unexpected publish notifications: %v", notified)
+	}
+
+	result, err := posts.PublishScheduled(now)
+	if err != nil {
+		t.Fatalf("PublishScheduled: %s", err)
+	}
+	if len(result) != 1 || result[0].Title != "Due" {
+		t.Fatalf("expected only the due post to be published, got %v", result)
+	}
+	if len(notified) != 2 || notified[1] != "Due" {
+		t.Errorf("scheduled publish didn't notify: %v", notified)
+	}
+
+	// The index is up to date.
+	idx, _ := posts.GetIndex()
+	due := idx.Posts[result[0].ID]
+	if due.Privacy != "public" || !due.Created.Equal(due.PublishAt) {
+		t.Errorf("unexpected index entry: %+v", due)
+	}
+
+	// Nothing is published twice.
+	if result, _ := posts.PublishScheduled(now); len(result) != 0 {
+		t.Errorf("expected nothing more to publish, got %v", result)
+	}
+}
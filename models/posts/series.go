@@ -0,0 +1,263 @@
+package posts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+)
+
+func init() {
+	// Secondary indexes on the series, to find them by URL fragment and by
+	// the posts in them.
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "blog/series",
+		Field:      "fragment",
+		New:        func() interface{} { return &Series{} },
+		Values: func(v interface{}) []string {
+			return []string{v.(*Series).Fragment}
+		},
+	})
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "blog/series",
+		Field:      "posts",
+		New:        func() interface{} { return &Series{} },
+		Values: func(v interface{}) []string {
+			var ids []string
+			for _, id := range v.(*Series).Posts {
+				ids = append(ids, strconv.Itoa(id))
+			}
+			return ids
+		},
+	})
+}
+
+// Series is an ordered set of blog posts that belong together, like the parts
+// of a long tutorial. A post can be in one series at a time.
+type Series struct {
+	ID       int       `json:"id"`
+	Title    string    `json:"title"`
+	Fragment string    `json:"fragment"`
+	Posts    []int     `json:"posts"` // post IDs in reading order
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+}
+
+// LoadSeries loads a series by its ID.
+func LoadSeries(id int) (*Series, error) {
+	s := &Series{}
+	err := DB.Get(fmt.Sprintf("blog/series/%d", id), &s)
+	return s, err
+}
+
+// LoadSeriesFragment loads a series by its URL fragment.
+func LoadSeriesFragment(fragment string) (*Series, error) {
+	docs, err := DB.FindBy("blog/series", "fragment", fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(docs) > 0 {
+		s := &Series{}
+		err := DB.Get(docs[0], &s)
+		return s, err
+	}
+
+	return nil, errors.New("no such series found")
+}
+
+// SeriesOf finds the series a post belongs to. It returns nil if the post
+// isn't in one.
+func SeriesOf(postID int) (*Series, error) {
+	docs, err := DB.FindBy("blog/series", "posts", strconv.Itoa(postID))
+	if err != nil || len(docs) == 0 {
+		return nil, err
+	}
+
+	s := &Series{}
+	err = DB.Get(docs[0], &s)
+	return s, err
+}
+
+// AllSeries returns every series, sorted by title.
+func AllSeries() ([]*Series, error) {
+	result := []*Series{}
+	docs, err := DB.List("blog/series")
+	if err != nil {
+		// No series have been made yet.
+		return result, nil
+	}
+
+	for _, doc := range docs {
+		s := &Series{}
+		if err := DB.Get(doc, &s); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Title < result[j].Title
+	})
+	return result, nil
+}
+
+// Part returns the 1-based position of a post in the series, or 0 if it isn't
+// in it.
+func (s *Series) Part(postID int) int {
+	for i, id := range s.Posts {
+		if id == postID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Save the series.
+func (s *Series) Save() error {
+	if s.Title == "" {
+		return errors.New("the series needs a title")
+	}
+
+	if s.ID == 0 {
+		id, err := DB.NextSequence("blog/series")
+		if err != nil {
+			return fmt.Errorf("failed to assign a series ID: %v", err)
+		}
+		s.ID = id
+	}
+
+	// Generate a unique URL fragment if needed.
+	if s.Fragment == "" {
+		base := makeFragment(s.Title)
+		if base == "" {
+			base = fmt.Sprintf("series-%d", s.ID)
+		}
+
+		s.Fragment = base
+		for i := 1; ; i++ {
+			exist, err := LoadSeriesFragment(s.Fragment)
+			if err != nil || exist.ID == s.ID {
+				break
+			}
+			if i > 100 {
+				return fmt.Errorf("failed to generate a unique URL fragment for '%s' after 100 attempts", base)
+			}
+			s.Fragment = fmt.Sprintf("%s-%d", base, i)
+		}
+	}
+
+	if s.Created.IsZero() {
+		s.Created = time.Now().UTC()
+	}
+	s.Updated = time.Now().UTC()
+	if s.Posts == nil {
+		s.Posts = []int{}
+	}
+
+	return DB.Commit(s.key(), s)
+}
+
+// Delete the series. Its posts are left alone.
+func (s *Series) Delete() error {
+	if s.ID == 0 {
+		return errors.New("series has no ID")
+	}
+	return DB.Delete(s.key())
+}
+
+// errUnchanged stops an update of a series that doesn't need to be written.
+var errUnchanged = errors.New("unchanged")
+
+// key is the series' document in JsonDB.
+func (s *Series) key() string {
+	return fmt.Sprintf("blog/series/%d", s.ID)
+}
+
+// SetSeries puts a post into a series at the given 1-based part number, taking
+// it out of any other series it was in. A part of 0 keeps the post where it
+// was, or adds it to the end. A seriesID of 0 just takes the post out of its
+// series. A series left with no posts is deleted.
+//
+// Each series is changed under its lock, so posts added to or moved within it
+// at the same time aren't lost.
+func SetSeries(postID, seriesID, part int) error {
+	current, err := SeriesOf(postID)
+	if err != nil {
+		return err
+	}
+
+	// Leaving the old series?
+	if current != nil && current.ID != seriesID {
+		if err := current.remove(postID); err != nil {
+			return err
+		}
+	}
+	if seriesID == 0 {
+		return nil
+	}
+
+	s := &Series{ID: seriesID}
+	err = DB.Update(s.key(), s, func() error {
+		if !DB.Exists(s.key()) {
+			return jsondb.ErrNotFound
+		}
+
+		// Already in the right place?
+		at := s.Part(postID)
+		if at > 0 && (part == 0 || part == at) {
+			return errUnchanged
+		}
+
+		// Take it out, then put it back where it belongs.
+		ids := []int{}
+		for _, id := range s.Posts {
+			if id != postID {
+				ids = append(ids, id)
+			}
+		}
+		if part < 1 || part > len(ids) {
+			part = len(ids) + 1
+		}
+		ids = append(ids[:part-1], append([]int{postID}, ids[part-1:]...)...)
+
+		s.Posts = ids
+		s.Updated = time.Now().UTC()
+		return nil
+	})
+	if err == errUnchanged {
+		return nil
+	}
+	return err
+}
+
+// remove takes a post out of the series, deleting the series if it was the
+// last one.
+func (s *Series) remove(postID int) error {
+	return DB.TransactionOn([]string{s.key()}, func(tx *jsondb.Tx) error {
+		*s = Series{ID: s.ID}
+		if err := tx.Get(s.key(), s); err == jsondb.ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		ids := []int{}
+		for _, id := range s.Posts {
+			if id != postID {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) == 0 {
+			tx.Delete(s.key())
+			return nil
+		}
+		s.Posts = ids
+		s.Updated = time.Now().UTC()
+		return tx.Commit(s.key(), s)
+	})
+}
@@ -0,0 +1,139 @@
+package posts_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/posts"
+)
+
+func TestSeries(t *testing.T) {
+	root, err := ioutil.TempDir("", "posts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	posts.DB = jsondb.New(root)
+
+	a := &posts.Series{Title: "Go Tutorial"}
+	b := &posts.Series{Title: "Go Tutorial"}
+	for _, s := range []*posts.Series{a, b} {
+		if err := s.Save(); err != nil {
+			t.Fatalf("Save: %s", err)
+		}
+	}
+	if a.Fragment != "go-tutorial" || b.Fragment != "go-tutorial-1" {
+		t.Errorf("unexpected fragments: %s, %s", a.Fragment, b.Fragment)
+	}
+
+	expect := func(s *posts.Series, ids ...int) {
+		t.Helper()
+		loaded, err := posts.LoadSeries(s.ID)
+		if err != nil {
+			t.Fatalf("LoadSeries(%d): %s", s.ID, err)
+		}
+		if !reflect.DeepEqual(loaded.Posts, ids) {
+			t.Errorf("series %d: expected posts %v, got %v", s.ID, ids, loaded.Posts)
+		}
+	}
+	set := func(postID, seriesID, part int) {
+		t.Helper()
+		if err := posts.SetSeries(postID, seriesID, part); err != nil {
+			t.Fatalf("SetSeries(%d, %d, %d): %s", postID, seriesID, part, err)
+		}
+	}
+
+	set(1, a.ID, 0)
+	set(3, a.ID, 0)
+	set(2, a.ID, 2)
+	expect(a, 1, 2, 3)
+
+	// Keeps its place when saved again without a part number.
+	set(2, a.ID, 0)
+	expect(a, 1, 2, 3)
+
+	// Reorder.
+	set(3, a.ID, 1)
+	expect(a, 3, 1, 2)
+
+	// Move to the other series.
+	set(1, b.ID, 0)
+	expect(a, 3, 2)
+	expect(b, 1)
+	if s, err := posts.SeriesOf(1); err != nil || s.ID != b.ID {
+		t.Errorf("SeriesOf(1): expected series %d, got %+v (%v)", b.ID, s, err)
+	}
+
+	// Taking out the last post deletes the series.
+	set(1, 0, 0)
+	if _, err := posts.LoadSeries(b.ID); err == nil {
+		t.Error("expected the emptied series to be deleted")
+	}
+	if s, err := posts.SeriesOf(1); err != nil || s != nil {
+		t.Errorf("SeriesOf(1): expected no series, got %+v (%v)", s, err)
+	}
+}
+
+func TestSetSeriesConcurrently(t *testing.T) {
+	root, err := ioutil.TempDir("", "posts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	posts.DB = jsondb.New(root)
+
+	s := &posts.Series{Title: "Parts"}
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+
+	// Posts added to and taken out of the same series at the same time
+	// mustn't lose each other's changes.
+	const count = 20
+	run := func(seriesID func(postID int) int, postIDs ...int) {
+		var wg sync.WaitGroup
+		for _, id := range postIDs {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				if err := posts.SetSeries(id, seriesID(id), 0); err != nil {
+					t.Errorf("SetSeries(%d): %s", id, err)
+				}
+			}(id)
+		}
+		wg.Wait()
+	}
+	expect := func(label string, ids ...int) {
+		t.Helper()
+		loaded, err := posts.LoadSeries(s.ID)
+		if err != nil {
+			t.Fatalf("%s: LoadSeries: %s", label, err)
+		}
+		got := append([]int{}, loaded.Posts...)
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, ids) {
+			t.Errorf("%s: expected posts %v, got %v", label, ids, got)
+		}
+	}
+
+	var all, odd, even []int
+	for id := 1; id <= count; id++ {
+		all = append(all, id)
+		if id%2 == 1 {
+			odd = append(odd, id)
+		} else {
+			even = append(even, id)
+		}
+	}
+
+	run(func(int) int { return s.ID }, all...)
+	expect("after adding", all...)
+
+	run(func(int) int { return 0 }, even...)
+	expect("after removing", odd...)
+}
@@ -8,3 +8,15 @@ func (a ByUpdated) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
 func (a ByUpdated) Less(i, j int) bool {
 	return a[i].Updated.Before(a[i].Updated) || a[i].ID < a[j].ID
 }
+
+// ByCreated sorts blog entries by when they were first posted.
+type ByCreated []Post
+
+func (a ByCreated) Len() int      { return len(a) }
+func (a ByCreated) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a ByCreated) Less(i, j int) bool {
+	if !a[i].Created.Equal(a[j].Created) {
+		return a[i].Created.Before(a[j].Created)
+	}
+	return a[i].ID < a[j].ID
+}
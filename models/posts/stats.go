@@ -0,0 +1,90 @@
+package posts
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/search"
+)
+
+// WordsPerMinute is the reading speed that reading times are estimated at.
+const WordsPerMinute = 200
+
+// Things in a post's source that aren't words a reader reads.
+var (
+	reHTMLTag      = regexp.MustCompile(`<[^>]*>`)
+	reMarkdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+)
+
+func init() {
+	// Version 1: posts and their index entries got a word count.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "blog/posts",
+		Version:    1,
+		Migrate: func(doc map[string]interface{}) error {
+			body, _ := doc["body"].(string)
+			doc["wordCount"] = CountWords(body)
+			return nil
+		},
+	})
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "blog/index",
+		Version:    1,
+		Migrate: func(doc map[string]interface{}) error {
+			entries, _ := doc["posts"].(map[string]interface{})
+			for id, entry := range entries {
+				entry, ok := entry.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if _, ok := entry["wordCount"].(json.Number); ok {
+					continue
+				}
+
+				p := &Post{}
+				if err := DB.Get(fmt.Sprintf("blog/posts/%s", id), &p); err != nil {
+					continue
+				}
+				entry["wordCount"] = p.WordCount
+			}
+			return nil
+		},
+	})
+
+	// Version 2: the index lost its map of URL fragments to the "fragment"
+	// index on the posts, which also replaced the older blog/fragments
+	// documents.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "blog/index",
+		Version:    2,
+		Migrate: func(doc map[string]interface{}) error {
+			delete(doc, "fragments")
+			return nil
+		},
+	})
+	jsondb.RetireCollection("blog/fragments")
+}
+
+// CountWords counts the words in the source of a post, leaving out its HTML
+// tags and the addresses of its Markdown links and images.
+func CountWords(body string) int {
+	body = reMarkdownLink.ReplaceAllString(body, "$1")
+	body = reHTMLTag.ReplaceAllString(body, " ")
+
+	var count int
+	for _, word := range strings.Fields(body) {
+		if strings.IndexFunc(word, search.IsWordRune) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// ReadingTime estimates how many minutes it takes to read the post, rounded
+// up. It's zero only for a post with no words.
+func (p Post) ReadingTime() int {
+	return (p.WordCount + WordsPerMinute - 1) / WordsPerMinute
+}
@@ -0,0 +1,63 @@
+package posts_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/posts"
+)
+
+func TestCountWords(t *testing.T) {
+	var tests = []struct {
+		body   string
+		expect int
+	}{
+		{"", 0},
+		{"Hello, world!", 2},
+		{"# Title\n\nSee [my site](http://example.com/a/b) - it's <b>great</b>.", 6},
+		{"![a cat](/static/cat.jpg)<snip>Two<br>words", 4},
+	}
+	for _, test := range tests {
+		if n := posts.CountWords(test.body); n != test.expect {
+			t.Errorf("CountWords(%q): expected %d, got %d", test.body, test.expect, n)
+		}
+	}
+
+	for words, minutes := range map[int]int{0: 0, 1: 1, 200: 1, 201: 2} {
+		if n := (posts.Post{WordCount: words}).ReadingTime(); n != minutes {
+			t.Errorf("ReadingTime for %d words: expected %d, got %d", words, minutes, n)
+		}
+	}
+}
+
+func TestWordCountMigration(t *testing.T) {
+	root, err := ioutil.TempDir("", "posts-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	posts.DB = jsondb.New(root)
+
+	// A post and blog index from before word counts were kept.
+	files := map[string]string{
+		"blog/posts/1.json": `{"id": 1, "title": "Old", "fragment": "old", "body": "one two three", "privacy": "public"}`,
+		"blog/index.json":   `{"posts": {"1": {"id": 1, "title": "Old", "fragment": "old", "privacy": "public"}}, "thumbnails": {}}`,
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	idx, err := posts.GetIndex()
+	if err != nil {
+		t.Fatalf("GetIndex: %s", err)
+	}
+	if n := idx.Posts[1].WordCount; n != 3 {
+		t.Errorf("expected the index to have 3 words for the post, got %d", n)
+	}
+}
@@ -0,0 +1,269 @@
+// Package search maintains a full-text inverted index of the site's content.
+package search
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/kirsle/blog/jsondb"
+)
+
+// DB is a reference to the parent app's JsonDB object.
+var DB *jsondb.DB
+
+// indexDocument is where the index is kept in JsonDB.
+const indexDocument = "search/index"
+
+// Kinds of documents in the index.
+const (
+	KindPost = "post"
+	KindPage = "page"
+)
+
+// How much a term counts for, depending on where it appears.
+const (
+	titleWeight = 5
+	tagWeight   = 3
+	bodyWeight  = 1
+
+	// Repeating a word in the body only helps up to a point.
+	maxBodyCount = 10
+)
+
+// Document is a piece of content to add to the index.
+type Document struct {
+	Entry
+	Text string // the body to index; it isn't stored
+}
+
+// Entry is what the index remembers about a document, to show in results.
+type Entry struct {
+	Key     string    `json:"key"`  // unique, i.e. "post/12" or "page/about"
+	Kind    string    `json:"kind"` // KindPost or KindPage
+	Title   string    `json:"title"`
+	URL     string    `json:"url"`
+	Privacy string    `json:"privacy,omitempty"` // posts only
+	Tags    []string  `json:"tags,omitempty"`
+	Date    time.Time `json:"date"`
+	ModTime time.Time `json:"modTime,omitempty"` // of a page's file on disk
+}
+
+// Result is a search hit.
+type Result struct {
+	Entry
+	Score int
+}
+
+// Index is the stored inverted index.
+type Index struct {
+	Terms   map[string]map[string]int `json:"terms"`   // term -> document key -> weight
+	Entries map[string]*Entry         `json:"entries"` // document key -> entry
+	Keys    map[string][]string       `json:"keys"`    // document key -> its terms
+}
+
+// newIndex returns an empty index.
+func newIndex() *Index {
+	return &Index{
+		Terms:   map[string]map[string]int{},
+		Entries: map[string]*Entry{},
+		Keys:    map[string][]string{},
+	}
+}
+
+// Exists returns whether the index has been built.
+func Exists() bool {
+	return DB.Exists(indexDocument)
+}
+
+// Load the index.
+func Load() (*Index, error) {
+	idx := newIndex()
+	err := DB.Get(indexDocument, &idx)
+	if err == jsondb.ErrNotFound {
+		return newIndex(), nil
+	}
+	return idx, err
+}
+
+// Update adds documents to the index, replacing any older copies of them.
+func Update(docs ...Document) error {
+	return modify(func(idx *Index) {
+		for _, doc := range docs {
+			idx.add(doc)
+		}
+	})
+}
+
+// Remove documents from the index by their keys.
+func Remove(keys ...string) error {
+	return modify(func(idx *Index) {
+		for _, key := range keys {
+			idx.remove(key)
+		}
+	})
+}
+
+// Rebuild replaces the whole index with the given documents.
+func Rebuild(docs []Document) error {
+	return modify(func(idx *Index) {
+		*idx = *newIndex()
+		for _, doc := range docs {
+			idx.add(doc)
+		}
+	})
+}
+
+// modify loads the index, changes it and saves it back under its lock.
+func modify(fn func(idx *Index)) error {
+	idx := newIndex()
+	return DB.Update(indexDocument, idx, func() error {
+		if idx.Terms == nil || idx.Entries == nil || idx.Keys == nil {
+			*idx = *newIndex()
+		}
+		fn(idx)
+		return nil
+	})
+}
+
+// add indexes a document.
+func (idx *Index) add(doc Document) {
+	idx.remove(doc.Key)
+
+	weights := map[string]int{}
+	for _, term := range Terms(doc.Title) {
+		weights[term] += titleWeight
+	}
+	for _, tag := range doc.Tags {
+		for _, term := range Terms(tag) {
+			weights[term] += tagWeight
+		}
+	}
+	body := map[string]int{}
+	for _, word := range Words(doc.Text) {
+		if term, ok := normalize(word); ok && body[term] < maxBodyCount {
+			body[term]++
+		}
+	}
+	for term, count := range body {
+		weights[term] += count * bodyWeight
+	}
+
+	terms := make([]string, 0, len(weights))
+	for term, weight := range weights {
+		if idx.Terms[term] == nil {
+			idx.Terms[term] = map[string]int{}
+		}
+		idx.Terms[term][doc.Key] = weight
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	entry := doc.Entry
+	idx.Entries[doc.Key] = &entry
+	idx.Keys[doc.Key] = terms
+}
+
+// remove drops a document from the index.
+func (idx *Index) remove(key string) {
+	for _, term := range idx.Keys[key] {
+		delete(idx.Terms[term], key)
+		if len(idx.Terms[term]) == 0 {
+			delete(idx.Terms, term)
+		}
+	}
+	delete(idx.Keys, key)
+	delete(idx.Entries, key)
+}
+
+// Search finds the documents containing every term of the query, best
+// matches first.
+func (idx *Index) Search(query string) []Result {
+	terms := Terms(query)
+	if len(terms) == 0 {
+		return []Result{}
+	}
+
+	// Start from the rarest term to keep the candidate list short.
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.Terms[terms[i]]) < len(idx.Terms[terms[j]])
+	})
+
+	results := []Result{}
+	for key, weight := range idx.Terms[terms[0]] {
+		score := weight
+		for _, term := range terms[1:] {
+			w, ok := idx.Terms[term][key]
+			if !ok {
+				score = 0
+				break
+			}
+			score += w
+		}
+
+		if entry, ok := idx.Entries[key]; ok && score > 0 {
+			results = append(results, Result{
+				Entry: *entry,
+				Score: score,
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Date.After(results[j].Date)
+	})
+	return results
+}
+
+// stopWords are too common to be worth indexing.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true,
+	"with": true,
+}
+
+// Terms splits text into the lowercased, de-duplicated words that the index
+// is keyed by, in the order they first appear.
+func Terms(text string) []string {
+	var (
+		result []string
+		seen   = map[string]bool{}
+	)
+	for _, word := range Words(text) {
+		term, ok := normalize(word)
+		if !ok || seen[term] {
+			continue
+		}
+		seen[term] = true
+		result = append(result, term)
+	}
+	return result
+}
+
+// normalize turns a word into its index term, or returns false if the word
+// isn't worth indexing.
+func normalize(word string) (string, bool) {
+	term := strings.ToLower(word)
+	if len([]rune(term)) < 2 || stopWords[term] {
+		return "", false
+	}
+	return term, true
+}
+
+// Words splits text into words the same way the index does.
+func Words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !IsWordRune(r)
+	})
+}
+
+// IsWordRune returns whether a character is part of a word.
+func IsWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,97 @@
+package search_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/search"
+)
+
+func TestSearch(t *testing.T) {
+	root, err := ioutil.TempDir("", "search-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	search.DB = jsondb.New(root)
+
+	now := time.Now()
+	err = search.Update(
+		search.Document{
+			Entry: search.Entry{Key: "post/1", Kind: search.KindPost, Title: "Gophers in the garden", Date: now},
+			Text:  "A story about golang and the garden.",
+		},
+		search.Document{
+			Entry: search.Entry{Key: "post/2", Kind: search.KindPost, Title: "Cooking", Tags: []string{"golang"}, Date: now},
+			Text:  "Recipes for the garden harvest.",
+		},
+		search.Document{
+			Entry: search.Entry{Key: "page/about", Kind: search.KindPage, Title: "About", Date: now},
+			Text:  "Nothing to see here.",
+		},
+	)
+	if err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+
+	var tests = []struct {
+		query  string
+		expect []string
+	}{
+		{"garden", []string{"post/1", "post/2"}}, // title beats body
+		{"GOLANG garden", []string{"post/1", "post/2"}},
+		{"gophers cooking", []string{}},
+		{"the", []string{}},
+		{"see", []string{"page/about"}},
+	}
+
+	check := func() {
+		idx, err := search.Load()
+		if err != nil {
+			t.Fatalf("Load: %s", err)
+		}
+		for _, test := range tests {
+			results := idx.Search(test.query)
+			var keys []string
+			for _, result := range results {
+				keys = append(keys, result.Key)
+			}
+			if len(keys) != len(test.expect) {
+				t.Errorf("Search(%q): expected %v, got %v", test.query, test.expect, keys)
+				continue
+			}
+			for i := range keys {
+				if keys[i] != test.expect[i] {
+					t.Errorf("Search(%q): expected %v, got %v", test.query, test.expect, keys)
+					break
+				}
+			}
+		}
+	}
+	check()
+
+	// Removing and re-adding a document replaces its old terms.
+	if err := search.Remove("post/2"); err != nil {
+		t.Fatalf("Remove: %s", err)
+	}
+	err = search.Update(search.Document{
+		Entry: search.Entry{Key: "page/about", Kind: search.KindPage, Title: "About", Date: now},
+		Text:  "Updated.",
+	})
+	if err != nil {
+		t.Fatalf("Update: %s", err)
+	}
+	tests = []struct {
+		query  string
+		expect []string
+	}{
+		{"garden", []string{"post/1"}},
+		{"cooking", []string{}},
+		{"see", []string{}},
+		{"updated", []string{"page/about"}},
+	}
+	check()
+}
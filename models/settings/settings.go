@@ -10,6 +10,109 @@ import (
 // DB is a reference to the parent app's JsonDB object.
 var DB *jsondb.DB
 
+func init() {
+	// Version 1: the cache section was added; sites configured before then
+	// would otherwise get a zero-sized memory cache.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "app/settings",
+		Version:    1,
+		Migrate: func(doc map[string]interface{}) error {
+			if _, ok := doc["cache"]; !ok {
+				doc["cache"] = map[string]interface{}{
+					"maxKeys": 10000,
+				}
+			}
+			return nil
+		},
+	})
+
+	// Version 2: the settings page sent the posts per feed under the wrong
+	// field name, so saving it stored a zero, and the feeds always had 20
+	// posts regardless. Keep them that way.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "app/settings",
+		Version:    2,
+		Migrate: func(doc map[string]interface{}) error {
+			blog, ok := doc["blog"].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			blog["postsPerFeed"] = DefaultPostsPerFeed
+			return nil
+		},
+	})
+
+	// Version 3: comment moderation was added. Existing sites keep posting
+	// comments right away until they choose otherwise.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "app/settings",
+		Version:    3,
+		Migrate: func(doc map[string]interface{}) error {
+			if _, ok := doc["comments"]; !ok {
+				doc["comments"] = map[string]interface{}{
+					"moderation": AutoApprove,
+				}
+			}
+			return nil
+		},
+	})
+
+	// Version 4: threaded replies were added, nested up to DefaultMaxDepth.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "app/settings",
+		Version:    4,
+		Migrate: func(doc map[string]interface{}) error {
+			comments, ok := doc["comments"].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			if _, ok := comments["maxDepth"]; !ok {
+				comments["maxDepth"] = DefaultMaxDepth
+			}
+			return nil
+		},
+	})
+
+	// Version 5: spam filters were added, and existing sites get the default
+	// ones turned on.
+	jsondb.RegisterMigration(jsondb.Migration{
+		Collection: "app/settings",
+		Version:    5,
+		Migrate: func(doc map[string]interface{}) error {
+			if _, ok := doc["spam"]; !ok {
+				doc["spam"] = map[string]interface{}{
+					"maxLinks":   DefaultMaxLinks,
+					"blocklist":  []string{},
+					"ipRate":     DefaultRateLimit,
+					"emailRate":  DefaultRateLimit,
+					"classifier": true,
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// DefaultPostsPerFeed is how many posts the feeds have by default, as many as
+// they had before it was a setting.
+const DefaultPostsPerFeed = 20
+
+// DefaultMaxDepth is how deeply comment replies are nested by default.
+const DefaultMaxDepth = 4
+
+// Default spam filter limits.
+const (
+	DefaultMaxLinks  = 5  // links per message
+	DefaultRateLimit = 10 // messages per hour
+)
+
+// Comment moderation modes.
+const (
+	ModerateAll = "hold-all"     // every comment waits for a moderator
+	ModerateNew = "hold-new"     // only comments from first-time commenters wait
+	AutoApprove = "auto-approve" // every comment goes up right away
+)
+
 // Settings holds the global app settings.
 type Settings struct {
 	// Only gets set to true on save(), this determines whether
@@ -28,6 +131,10 @@ type Settings struct {
 	Security struct {
 		SecretKey string `json:"secretKey"` // Session cookie secret key
 		HashCost  int    `json:"hashCost"`  // Bcrypt hash cost for passwords
+
+		// Reverse proxies (IP addresses or CIDR ranges) whose X-Forwarded-For
+		// header is believed when logging visitors' IP addresses.
+		TrustedProxies []string `json:"trustedProxies,omitempty"`
 	} `json:"security"`
 
 	// Blog settings.
@@ -36,6 +143,29 @@ type Settings struct {
 		PostsPerFeed int `json:"postsPerFeed"`
 	} `json:"blog"`
 
+	// Comment settings.
+	Comments struct {
+		Moderation string `json:"moderation"` // ModerateAll, ModerateNew or AutoApprove
+		MaxDepth   int    `json:"maxDepth"`   // how deeply replies nest; 1 turns replies off
+	} `json:"comments"`
+
+	// Spam filters for the comment, contact and question forms. A limit of
+	// zero turns that filter off.
+	Spam struct {
+		MaxLinks   int      `json:"maxLinks"`   // links allowed in a message
+		Blocklist  []string `json:"blocklist"`  // words, phrases or /regexps/
+		IPRate     int      `json:"ipRate"`     // messages per hour from an IP address
+		EmailRate  int      `json:"emailRate"`  // messages per hour from an email address
+		Classifier bool     `json:"classifier"` // use the trained spam classifier
+	} `json:"spam"`
+
+	// JsonDB cache settings.
+	Cache struct {
+		WatchFiles bool `json:"watchFiles"` // evict cached documents when their files change
+		Memory     bool `json:"memory"`     // use an in-process cache when Redis isn't enabled
+		MaxKeys    int  `json:"maxKeys"`    // size limit of the in-process cache
+	} `json:"cache"`
+
 	// Redis settings for caching in JsonDB.
 	Redis struct {
 		Enabled bool   `json:"enabled"`
@@ -66,7 +196,14 @@ func Defaults() *Settings {
 	s.Security.HashCost = 14
 	s.Security.SecretKey = RandomKey()
 	s.Blog.PostsPerPage = 10
-	s.Blog.PostsPerFeed = 10
+	s.Blog.PostsPerFeed = DefaultPostsPerFeed
+	s.Comments.Moderation = ModerateNew
+	s.Comments.MaxDepth = DefaultMaxDepth
+	s.Spam.MaxLinks = DefaultMaxLinks
+	s.Spam.IPRate = DefaultRateLimit
+	s.Spam.EmailRate = DefaultRateLimit
+	s.Spam.Classifier = true
+	s.Cache.MaxKeys = 10000
 	s.Redis.Host = "localhost"
 	s.Redis.Port = 6379
 	s.Redis.DB = 0
@@ -3,8 +3,6 @@ package users
 import (
 	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 
 	"github.com/kirsle/blog/jsondb"
 	"golang.org/x/crypto/bcrypt"
@@ -33,9 +31,19 @@ type User struct {
 	readonly bool
 }
 
-// ByName model maps usernames to their IDs.
-type ByName struct {
-	ID int `json:"id"`
+func init() {
+	// Look up users by their username.
+	jsondb.RegisterIndex(jsondb.Index{
+		Collection: "users/by-id",
+		Field:      "username",
+		New:        func() interface{} { return &User{} },
+		Values: func(v interface{}) []string {
+			return []string{v.(*User).Username}
+		},
+	})
+
+	// The index replaced the documents that mapped usernames to user IDs.
+	jsondb.RetireCollection("users/by-name")
 }
 
 // Create a new user.
@@ -54,7 +62,11 @@ func Create(u *User) error {
 	}
 
 	// Assign the next ID.
-	u.ID = nextID()
+	id, err := DB.NextSequence("users/by-id")
+	if err != nil {
+		return fmt.Errorf("failed to assign a user ID: %v", err)
+	}
+	u.ID = id
 
 	// Hash the password.
 	u.SetPassword(u.Password)
@@ -105,7 +117,8 @@ func (u *User) SetPassword(password string) error {
 // UsernameExists checks if a username is taken.
 func UsernameExists(username string) bool {
 	username = Normalize(username)
-	return DB.Exists("users/by-name/" + username)
+	docs, err := DB.FindBy("users/by-id", "username", username)
+	return err == nil && len(docs) > 0
 }
 
 // LoadUsername loads a user by username.
@@ -113,15 +126,16 @@ func LoadUsername(username string) (*User, error) {
 	username = Normalize(username)
 	u := &User{}
 
-	// Look up the user ID by name.
-	name := ByName{}
-	err := DB.Get("users/by-name/"+username, &name)
+	// Look up the user by name.
+	docs, err := DB.FindBy("users/by-id", "username", username)
 	if err != nil {
 		return u, fmt.Errorf("failed to look up user ID for username %s: %v", username, err)
+	} else if len(docs) == 0 {
+		return u, fmt.Errorf("failed to look up user ID for username %s: %v", username, jsondb.ErrNotFound)
 	}
 
-	// And load that user.
-	return Load(name.ID)
+	err = DB.Get(docs[0], &u)
+	return u, err
 }
 
 // Load a user by their ID number.
@@ -150,53 +164,11 @@ func (u *User) Save() error {
 		return errors.New("can't save a user with no ID")
 	}
 
-	// Save the main DB file.
-	err := DB.Commit(u.key(), u)
-	if err != nil {
-		return err
-	}
-
-	// The username to ID mapping.
-	err = DB.Commit(u.nameKey(), ByName{u.ID})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Get the next user ID number.
-func nextID() int {
-	// Highest ID seen so far.
-	var highest int
-
-	users, err := DB.List("users/by-id")
-	if err != nil {
-		return 1
-	}
-
-	for _, doc := range users {
-		fields := strings.Split(doc, "/")
-		id, err := strconv.Atoi(fields[len(fields)-1])
-		if err != nil {
-			continue
-		}
-
-		if id > highest {
-			highest = id
-		}
-	}
-
-	// Return the highest +1
-	return highest + 1
+	// Save the main DB file. JsonDB keeps the username index in sync.
+	return DB.Commit(u.key(), u)
 }
 
 // DB key for users by ID number.
 func (u *User) key() string {
 	return fmt.Sprintf("users/by-id/%d", u.ID)
 }
-
-// DB key for users by username.
-func (u *User) nameKey() string {
-	return "users/by-name/" + u.Username
-}
@@ -0,0 +1,49 @@
+package blog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// serverLockName is the file under the user root's .private directory that a
+// running server holds a lock on for as long as it runs.
+const serverLockName = "server.lock"
+
+// errLocked is returned by lockFile when somebody else holds the lock.
+var errLocked = errors.New("the lock is held by another process")
+
+// claimUserRoot takes the lock that marks the user root as being served. The
+// operating system lets go of it when the process exits, however it exits.
+func (b *Blog) claimUserRoot() error {
+	fh, err := lockFile(filepath.Join(b.UserRoot, ".private", serverLockName))
+	if err != nil {
+		return err
+	}
+	b.serverLock = fh
+	return nil
+}
+
+// ServerRunning returns whether a blog server is running on a user root, for
+// commands like `blog backup` that can't keep its writes out while they work.
+//
+// It's only known on systems with flock(2); elsewhere (i.e. Windows) it always
+// returns false.
+func ServerRunning(userRoot string) bool {
+	fh, err := lockFile(filepath.Join(userRoot, ".private", serverLockName))
+	if err == errLocked {
+		return true
+	} else if err != nil {
+		return false
+	}
+	fh.Close()
+	return false
+}
+
+// openLockFile opens a lock file for lockFile, creating it if need be.
+func openLockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+}
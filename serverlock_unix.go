@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+package blog
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile opens a lock file and takes an exclusive lock on it without
+// waiting, returning errLocked if somebody else holds it. Closing the file
+// releases the lock.
+func lockFile(path string) (*os.File, error) {
+	fh, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(fh.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		fh.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return fh, nil
+}
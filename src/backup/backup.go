@@ -0,0 +1,226 @@
+// Package backup creates and restores full backups of a blog's user root.
+//
+// A backup is a gzipped tarball of everything under the user root: the JsonDB
+// documents and SQLite database under .private, uploaded photos, and any
+// user-defined pages and templates, all under a root/ directory. It ends with a
+// manifest.json listing the SHA-256 checksum of every file, which Restore
+// verifies before it touches the existing site.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/src/log"
+)
+
+// ManifestName is the name of the manifest inside the archive.
+const ManifestName = "manifest.json"
+
+// The user root's files are kept under this directory in the archive, so they
+// can't collide with the manifest.
+const rootDir = "root/"
+
+// ManifestVersion is the format version of backups written by this package.
+const ManifestVersion = 1
+
+// Database file names under the .private directory.
+const (
+	sqliteName   = "database.sqlite"
+	privateName  = ".private"
+	sqliteSuffix = "-journal"
+)
+
+// Manifest describes the contents of a backup.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+// File is a file in the backup, with its path relative to the user root.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Create writes a backup of the user root to `w`.
+//
+// JsonDB writes are held off for the duration, and the SQLite database is
+// copied while holding a lock that keeps other writers out, so the archive is
+// coherent even while the site is running. Those locks only work within this
+// process, though; see the blog's ServerRunning. JsonDB's transaction
+// journals are included, so if a backup does catch one in flight it's
+// finished when the restored site is next opened. Files named in `skip` (i.e.
+// the archive itself, if it's being written inside the user root) are left
+// out.
+func Create(w io.Writer, userRoot string, db *gorm.DB, jsonDB *jsondb.DB, skip ...string) error {
+	userRoot, err := filepath.Abs(userRoot)
+	if err != nil {
+		return err
+	}
+
+	skipped := map[string]bool{}
+	for _, name := range skip {
+		if abs, err := filepath.Abs(name); err == nil {
+			skipped[abs] = true
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	archive := &writer{
+		tar:      tar.NewWriter(gz),
+		manifest: Manifest{Version: ManifestVersion, Created: time.Now().UTC()},
+	}
+
+	err = jsonDB.Snapshot(func() error {
+		return lockSQLite(db, func() error {
+			return filepath.Walk(userRoot, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+
+				rel, err := filepath.Rel(userRoot, path)
+				if err != nil {
+					return err
+				}
+				rel = filepath.ToSlash(rel)
+
+				switch {
+				case rel == privateName+"/"+sqliteName+sqliteSuffix:
+					// A rollback journal is never part of a consistent copy.
+					return nil
+				case skipped[path]:
+					return nil
+				case info.IsDir():
+					return nil
+				case !info.Mode().IsRegular():
+					log.Warn("backup: skipping %s: not a regular file", rel)
+					return nil
+				}
+
+				return archive.addFile(rel, path, info)
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = archive.addManifest(); err != nil {
+		return err
+	}
+	if err = archive.tar.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// lockSQLite calls `fn` while holding a lock on the SQLite database that keeps
+// other writers out, so its file on disk can be copied safely.
+func lockSQLite(db *gorm.DB, fn func() error) error {
+	if db == nil {
+		return fn()
+	}
+
+	ctx := context.Background()
+	conn, err := db.DB().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// An immediate transaction takes SQLite's RESERVED lock: readers carry
+	// on, but nobody can write until we roll back.
+	if _, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("locking the SQLite database: %s", err)
+	}
+	defer conn.ExecContext(ctx, "ROLLBACK")
+
+	return fn()
+}
+
+// writer adds files to the archive and keeps track of the manifest.
+type writer struct {
+	tar      *tar.Writer
+	manifest Manifest
+}
+
+// addFile copies a file from disk into the archive.
+func (a *writer) addFile(name, path string, info os.FileInfo) error {
+	fh, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	header := &tar.Header{
+		Name:    rootDir + name,
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err = a.tar.WriteHeader(header); err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(a.tar, hash), fh)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	if n != info.Size() {
+		return fmt.Errorf("%s: changed size while it was being backed up", name)
+	}
+
+	a.manifest.Files = append(a.manifest.Files, File{
+		Path:   name,
+		Size:   n,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	})
+	return nil
+}
+
+// addManifest writes the manifest as the archive's last entry.
+func (a *writer) addManifest() error {
+	data, err := json.MarshalIndent(a.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    ManifestName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: a.manifest.Created,
+	}
+	if err = a.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = a.tar.Write(data)
+	return err
+}
+
+// cleanName validates the name of a file in the archive, rejecting anything
+// that would land outside of the directory it's extracted into.
+func cleanName(name string) (string, error) {
+	clean := filepath.ToSlash(filepath.Clean(name))
+	if name == "" || filepath.IsAbs(name) || strings.HasPrefix(name, "/") ||
+		clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("unsafe file name in archive: %q", name)
+	}
+	return clean, nil
+}
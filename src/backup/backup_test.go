@@ -0,0 +1,159 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/src/backup"
+)
+
+// makeSite creates a small user root to back up.
+func makeSite(t *testing.T, dir string) *jsondb.DB {
+	files := map[string]string{
+		"index.md":              "# Hello",
+		"manifest.json":         "{}",
+		"static/photos/a.jpg":   "not really a jpeg",
+		".private/.contact.log": "a message",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := jsondb.New(filepath.Join(dir, ".private"))
+	if err := db.Commit("blog/posts/1", map[string]string{"title": "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := filepath.Join(dir, "site")
+	db := makeSite(t, site)
+
+	var archive bytes.Buffer
+	if err := backup.Create(&archive, site, nil, db); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	// Change the site, then restore it.
+	ioutil.WriteFile(filepath.Join(site, "index.md"), []byte("changed"), 0644)
+	previous, err := backup.Restore(bytes.NewReader(archive.Bytes()), site)
+	if err != nil {
+		t.Fatalf("Restore: %s", err)
+	}
+
+	for name, expect := range map[string]string{
+		"index.md":                   "# Hello",
+		"manifest.json":              "{}",
+		".private/blog/posts/1.json": `"title": "Hi"`,
+	} {
+		data, _ := ioutil.ReadFile(filepath.Join(site, name))
+		if !strings.Contains(string(data), expect) {
+			t.Errorf("%s: expected %q, got %q", name, expect, data)
+		}
+	}
+
+	// The old copy was kept.
+	data, _ := ioutil.ReadFile(filepath.Join(previous, "index.md"))
+	if string(data) != "changed" {
+		t.Errorf("expected the old copy at %s, got %q", previous, data)
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	site := filepath.Join(dir, "site")
+	db := makeSite(t, site)
+
+	var good bytes.Buffer
+	if err := backup.Create(&good, site, nil, db); err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+
+	tests := map[string][]byte{
+		"tampered":  rewrite(t, good.Bytes(), "root/index.md", "# Evil", ""),
+		"extra":     rewrite(t, good.Bytes(), "", "", "root/extra.txt"),
+		"traversal": rewrite(t, good.Bytes(), "", "", "root/../../escape.txt"),
+		"manifest":  rewrite(t, good.Bytes(), "manifest.json", "", ""),
+	}
+	for name, archive := range tests {
+		if _, err := backup.Restore(bytes.NewReader(archive), site); err == nil {
+			t.Errorf("%s: expected Restore to fail", name)
+		}
+
+		// Nothing should have been touched.
+		data, _ := ioutil.ReadFile(filepath.Join(site, "index.md"))
+		if string(data) != "# Hello" {
+			t.Errorf("%s: the site was modified: %q", name, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+		t.Errorf("a file escaped the restore directory")
+	}
+}
+
+// rewrite copies an archive, replacing the content of the file `change` (or
+// dropping it, if `content` is empty) and adding a file named `add`.
+func rewrite(t *testing.T, archive []byte, change, content, add string) []byte {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	if add != "" {
+		tw.WriteHeader(&tar.Header{Name: add, Mode: 0644, Size: 1})
+		tw.Write([]byte("x"))
+	}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := ioutil.ReadAll(tr)
+		if header.Name == change {
+			if content == "" {
+				continue
+			}
+			data = []byte(content)
+			header.Size = int64(len(data))
+		}
+		tw.WriteHeader(header)
+		tw.Write(data)
+	}
+
+	tw.Close()
+	gw.Close()
+	return buf.Bytes()
+}
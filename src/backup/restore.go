@@ -0,0 +1,206 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errNoManifest is returned for archives without a manifest.
+var errNoManifest = errors.New("the archive has no " + ManifestName + "; is it a blog backup?")
+
+// Restore replaces the user root with the contents of a backup.
+//
+// The archive is first extracted into a staging directory next to the user
+// root, and every file in it is checked against the manifest. Only once that
+// all checks out is the existing user root moved aside, and its new location
+// is returned so nothing is lost. The blog shouldn't be running meanwhile.
+func Restore(r io.Reader, userRoot string) (string, error) {
+	userRoot, err := filepath.Abs(userRoot)
+	if err != nil {
+		return "", err
+	}
+
+	parent := filepath.Dir(userRoot)
+	if err = os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+
+	staging, err := ioutil.TempDir(parent, "."+filepath.Base(userRoot)+".restore-")
+	if err != nil {
+		return "", err
+	}
+	var restored bool
+	defer func() {
+		if !restored {
+			os.RemoveAll(staging)
+		}
+	}()
+
+	manifest, files, err := extract(r, staging)
+	if err != nil {
+		return "", err
+	}
+	if err = verify(manifest, files); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(staging, 0755); err != nil {
+		return "", err
+	}
+
+	// Everything checks out; swap the restored copy into place.
+	var previous string
+	if _, err = os.Stat(userRoot); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", userRoot, time.Now().Format("20060102-150405"))
+		if err = os.Rename(userRoot, previous); err != nil {
+			return "", err
+		}
+	}
+
+	if err = os.Rename(staging, userRoot); err != nil {
+		if previous != "" {
+			os.Rename(previous, userRoot)
+		}
+		return "", err
+	}
+
+	restored = true
+	return previous, nil
+}
+
+// extract unpacks an archive into a directory, returning its manifest and the
+// checksums of the files that were actually in it.
+func extract(r io.Reader, dir string) (*Manifest, map[string]File, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a gzipped backup: %s", err)
+	}
+	defer gz.Close()
+
+	var (
+		archive  = tar.NewReader(gz)
+		manifest *Manifest
+		files    = map[string]File{}
+	)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("reading the archive: %s", err)
+		}
+
+		name, err := cleanName(header.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Everything but the manifest lives under the root directory.
+		isManifest := name == ManifestName
+		if !isManifest {
+			if !strings.HasPrefix(name+"/", rootDir) {
+				return nil, nil, fmt.Errorf("%s: unexpected file in the archive", name)
+			}
+			name = strings.TrimPrefix(name+"/", rootDir)
+			name = strings.TrimSuffix(name, "/")
+			if name == "" {
+				continue
+			}
+		}
+
+		switch {
+		case isManifest:
+			manifest = &Manifest{}
+			if err := json.NewDecoder(archive).Decode(manifest); err != nil {
+				return nil, nil, fmt.Errorf("reading the manifest: %s", err)
+			}
+		case header.Typeflag == tar.TypeDir:
+			if err := os.MkdirAll(filepath.Join(dir, name), 0755); err != nil {
+				return nil, nil, err
+			}
+		case header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA:
+			if _, ok := files[name]; ok {
+				return nil, nil, fmt.Errorf("%s appears in the archive twice", name)
+			}
+			file, err := extractFile(archive, header, filepath.Join(dir, name))
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", name, err)
+			}
+			file.Path = name
+			files[name] = file
+		default:
+			return nil, nil, fmt.Errorf("%s: unsupported entry in the archive", name)
+		}
+	}
+
+	return manifest, files, nil
+}
+
+// extractFile writes one file from the archive to disk, returning its size
+// and checksum.
+func extractFile(archive io.Reader, header *tar.Header, path string) (File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return File{}, err
+	}
+
+	fh, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm()|0600)
+	if err != nil {
+		return File{}, err
+	}
+	defer fh.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(fh, hash), archive)
+	if err != nil {
+		return File{}, err
+	}
+
+	os.Chtimes(path, header.ModTime, header.ModTime)
+	return File{
+		Size:   n,
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+	}, fh.Close()
+}
+
+// verify checks the files extracted from an archive against its manifest.
+func verify(manifest *Manifest, files map[string]File) error {
+	if manifest == nil {
+		return errNoManifest
+	}
+	if manifest.Version > ManifestVersion {
+		return fmt.Errorf("the backup is format version %d, but this blog only understands up to version %d",
+			manifest.Version, ManifestVersion,
+		)
+	}
+
+	listed := map[string]bool{}
+	for _, expect := range manifest.Files {
+		listed[expect.Path] = true
+
+		got, ok := files[expect.Path]
+		if !ok {
+			return fmt.Errorf("%s is in the manifest but missing from the archive", expect.Path)
+		}
+		if got.Size != expect.Size || got.SHA256 != expect.SHA256 {
+			return fmt.Errorf("%s doesn't match its checksum in the manifest", expect.Path)
+		}
+	}
+
+	for name := range files {
+		if !listed[name] {
+			return fmt.Errorf("%s is in the archive but not in the manifest", name)
+		}
+	}
+
+	return nil
+}
@@ -14,6 +14,12 @@ func Register(r *mux.Router, authErrorFunc http.HandlerFunc) {
 	adminRouter := mux.NewRouter().PathPrefix("/admin").Subrouter().StrictSlash(true)
 	adminRouter.HandleFunc("/", indexHandler)
 	adminRouter.HandleFunc("/settings", settingsHandler)
+	adminRouter.HandleFunc("/cache", cacheHandler)
+	adminRouter.HandleFunc("/comments", commentsHandler)
+	adminRouter.HandleFunc("/comments/recent", recentCommentsHandler)
+	adminRouter.HandleFunc("/spam", spamHandler)
+	adminRouter.HandleFunc("/blocklist", blocklistHandler)
+	adminRouter.HandleFunc("/backup", backupHandler)
 	adminRouter.HandleFunc("/editor", editorHandler)
 	adminRouter.HandleFunc("/upload", uploadHandler)
 
@@ -4,12 +4,19 @@ Package admin provides controllers for admin features of the app.
 Routes
 
 	Admin Only
-	/admin/           Admin index page
-	/admin/settings   Manage app settings
-	/admin/editor     Web page editor
+	/admin/                  Admin index page
+	/admin/settings          Manage app settings
+	/admin/cache             Cache metrics and flushing
+	/admin/comments          Comment moderation queue
+	/admin/comments/recent   Search, edit and delete comments from every thread
+	/admin/spam              Review what the spam filters caught and train them
+	/admin/blocklist         Ban email addresses, IP addresses and CIDR ranges
+	/admin/backup            Download a full backup of the site
+	/admin/editor            Web page editor
 
 Related Models
 
+	comments
 	users
 */
 package admin
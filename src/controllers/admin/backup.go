@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// Backup writes a full backup of the site. It's set by the blog on startup.
+var Backup func(w io.Writer) error
+
+// backupHandler downloads a full backup of the site from the running server,
+// which is the only way to take one without stopping it: JsonDB's locks are
+// only held within the app's own process.
+//
+// The archive is built in a temp file first, since writes to the site are held
+// off while it's being made and the download may be slow.
+func backupHandler(w http.ResponseWriter, r *http.Request) {
+	if Backup == nil {
+		responses.FlashAndRedirect(w, r, "/admin", "Backups aren't available.")
+		return
+	}
+
+	fh, err := ioutil.TempFile("", "blog-backup-*.tar.gz")
+	if err != nil {
+		responses.FlashAndRedirect(w, r, "/admin", "Can't create the backup: %s", err)
+		return
+	}
+	defer os.Remove(fh.Name())
+	defer fh.Close()
+
+	if err := Backup(fh); err != nil {
+		log.Error("Backup failed: %s", err)
+		responses.FlashAndRedirect(w, r, "/admin", "Backup failed: %s", err)
+		return
+	}
+
+	now := time.Now()
+	filename := fmt.Sprintf("backup-%s.tar.gz", now.Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	http.ServeContent(w, r, filename, now, fh)
+}
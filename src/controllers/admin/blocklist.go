@@ -0,0 +1,38 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// blocklistHandler edits the ban list of email addresses, IP addresses and
+// CIDR ranges that may not post comments, contact messages or questions.
+func blocklistHandler(w http.ResponseWriter, r *http.Request) {
+	bans := comments.LoadBanList()
+	v := map[string]interface{}{
+		"Emails": bans.EmailList(),
+		"IPs":    bans.IPs,
+		"Hold":   bans.Hold,
+	}
+
+	if r.Method == http.MethodPost {
+		emails := lines(r.FormValue("emails"))
+		ips := lines(r.FormValue("ips"))
+		hold := r.FormValue("action") == "hold"
+
+		if err := bans.Save(emails, ips, hold); err != nil {
+			v["Error"] = err
+			v["Emails"] = emails
+			v["IPs"] = ips
+			v["Hold"] = hold
+		} else {
+			responses.FlashAndReload(w, r, "The ban list has been saved.")
+			return
+		}
+	}
+
+	render.Template(w, r, "admin/blocklist", v)
+}
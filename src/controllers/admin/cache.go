@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/jsondb/caches/metrics"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// Cache is the app's instrumented cache. It's set by the blog when a cache
+// backend is configured, and left nil otherwise.
+var Cache *metrics.Metrics
+
+// cacheHandler shows the cache metrics and lets the admin flush keys by
+// their prefix.
+func cacheHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if Cache == nil {
+			responses.FlashAndReload(w, r, "There is no cache configured.")
+			return
+		}
+
+		switch r.FormValue("action") {
+		case "flush":
+			prefix := r.FormValue("prefix")
+			all, err := Cache.Keys(prefix + "*")
+			if err != nil {
+				responses.FlashAndReload(w, r, "Error listing cache keys: %s", err)
+				return
+			}
+
+			// Leave the locks alone; other requests are holding them.
+			keys := []string{}
+			for _, key := range all {
+				if !strings.HasPrefix(key, jsondb.CacheLockPrefix) {
+					keys = append(keys, key)
+				}
+			}
+			if len(keys) > 0 {
+				Cache.Delete(keys...)
+			}
+
+			if prefix == "" {
+				responses.FlashAndReload(w, r, "Flushed all %d cache keys.", len(keys))
+			} else {
+				responses.FlashAndReload(w, r, "Flushed %d cache keys under %s", len(keys), prefix)
+			}
+		case "reset":
+			Cache.Reset()
+			responses.FlashAndReload(w, r, "Cache counters have been reset.")
+		default:
+			responses.FlashAndReload(w, r, "Unknown action.")
+		}
+		return
+	}
+
+	v := map[string]interface{}{
+		"Enabled": Cache != nil,
+	}
+	if Cache != nil {
+		v["Stats"] = Cache.Stats()
+		v["Since"] = Cache.Since()
+	}
+	render.Template(w, r, "admin/cache", v)
+}
@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/mail"
+	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+	"github.com/kirsle/blog/src/spam"
+)
+
+// commentsHandler is the comment moderation queue. It lists the comments
+// waiting for approval from every thread, and approves, rejects or bans them.
+func commentsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		moderateComment(w, r)
+		return
+	}
+
+	pending, err := comments.Pending()
+	if err != nil {
+		log.Error("Couldn't list the pending comments: %s", err)
+	}
+	for _, c := range pending {
+		c.HTML = template.HTML(markdown.RenderMarkdown(c.Body))
+		c.LoadAvatar()
+	}
+
+	render.Template(w, r, "admin/comments", map[string]interface{}{
+		"Pending": pending,
+		"Error":   err,
+	})
+}
+
+// moderateComment handles the queue's approve, reject, spam and ban buttons.
+// Approving a comment or marking it as spam also trains the spam classifier.
+func moderateComment(w http.ResponseWriter, r *http.Request) {
+	t, err := comments.Load(r.FormValue("thread"))
+	if err != nil {
+		responses.FlashAndReload(w, r, "That comment thread was not found.")
+		return
+	}
+	c, err := t.Find(r.FormValue("id"))
+	if err != nil {
+		responses.FlashAndReload(w, r, "That comment was not found.")
+		return
+	}
+
+	submission := &spam.Submission{
+		Kind:  spam.Comment,
+		Name:  c.Name,
+		Email: c.Email,
+		Body:  c.Body,
+	}
+
+	switch r.FormValue("action") {
+	case "approve":
+		if err := spam.Train(submission, false); err != nil {
+			log.Error("Couldn't train the spam classifier: %s", err)
+		}
+		if c, err = t.Approve(c.ID); err != nil {
+			responses.FlashAndReload(w, r, "Error approving the comment: %s", err)
+			return
+		}
+
+		// Now the thread's subscribers can hear about it.
+		c.ThreadID = t.ID
+		c.OriginURL = t.URL
+		c.Subject = t.Subject
+		mail.NotifyApproved(c)
+		responses.FlashAndReload(w, r, "Comment approved.")
+	case "reject":
+		if err := t.Delete(c.ID); err != nil {
+			responses.FlashAndReload(w, r, "Error rejecting the comment: %s", err)
+			return
+		}
+		responses.FlashAndReload(w, r, "Comment rejected.")
+	case "spam":
+		if err := spam.Train(submission, true); err != nil {
+			responses.FlashAndReload(w, r, "Error training the spam classifier: %s", err)
+			return
+		}
+		if err := t.Delete(c.ID); err != nil {
+			responses.FlashAndReload(w, r, "Error rejecting the comment: %s", err)
+			return
+		}
+		responses.FlashAndReload(w, r, "Comment rejected as spam.")
+	case "ban":
+		if c.Email == "" && c.IP == "" {
+			t.Delete(c.ID)
+			responses.FlashAndReload(w, r, "That comment had no email or IP address to ban, but it was rejected.")
+			return
+		}
+
+		bans := comments.LoadBanList()
+		if c.Email != "" {
+			if err := bans.Ban(c.Email); err != nil {
+				responses.FlashAndReload(w, r, "Error banning %s: %s", c.Email, err)
+				return
+			}
+		}
+		if c.IP != "" {
+			if err := bans.BanIP(c.IP); err != nil {
+				responses.FlashAndReload(w, r, "Error banning %s: %s", c.IP, err)
+				return
+			}
+		}
+		rejected := rejectPendingFrom(c.Email, c.IP)
+		responses.FlashAndReload(w, r, "Banned %s and rejected their %d pending comment(s).",
+			strings.Trim(c.Email+" "+c.IP, " "), rejected,
+		)
+	default:
+		responses.FlashAndReload(w, r, "Unknown action.")
+	}
+}
+
+// rejectPendingFrom deletes every pending comment posted with an email
+// address or from an IP address, returning how many there were.
+func rejectPendingFrom(email, ip string) int {
+	pending, err := comments.Pending()
+	if err != nil {
+		log.Error("Couldn't list the pending comments: %s", err)
+		return 0
+	}
+
+	var count int
+	for _, c := range pending {
+		sameEmail := email != "" && strings.EqualFold(c.Email, email)
+		sameIP := ip != "" && c.IP == ip
+		if !sameEmail && !sameIP {
+			continue
+		}
+		t := comments.New(c.ThreadID)
+		if err := t.Delete(c.ID); err != nil {
+			log.Error("Couldn't reject comment %s: %s", c.ID, err)
+			continue
+		}
+		count++
+	}
+	return count
+}
@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	searchctl "github.com/kirsle/blog/src/controllers/search"
+	"github.com/kirsle/blog/src/log"
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/src/responses"
 )
@@ -47,6 +49,7 @@ func editorHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				responses.Flash(w, r, "Error saving: %s", err)
 			} else {
+				reindexPages()
 				if render.HasHTMLSuffix(file) {
 					responses.FlashAndRedirect(w, r, render.URLFromPath(file), "Page saved successfully!")
 				} else {
@@ -60,6 +63,7 @@ func editorHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				responses.FlashAndRedirect(w, r, "/admin/editor", "Error deleting: %s", err)
 			} else {
+				reindexPages()
 				responses.FlashAndRedirect(w, r, "/admin/editor", "Page deleted!")
 				return
 			}
@@ -166,3 +170,10 @@ func editorFileList(w http.ResponseWriter, r *http.Request) {
 	}
 	render.Template(w, r, "admin/filelist", v)
 }
+
+// reindexPages updates the search index after a page is saved or deleted.
+func reindexPages() {
+	if err := searchctl.IndexPages(); err != nil {
+		log.Error("Error updating the search index: %s", err)
+	}
+}
@@ -0,0 +1,191 @@
+package admin
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// RecentPerPage is how many comments the recent comments page shows at a time.
+const RecentPerPage = 25
+
+// recentComment is a row on the recent comments page.
+type recentComment struct {
+	*comments.Comment
+	Key     string // "thread:id", for the form buttons
+	EditURL string
+}
+
+// recentCommentsHandler lists the newest comments from every thread, filtered
+// by thread, name, email and date, and edits or deletes them.
+func recentCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	query, filters, err := recentQuery(r)
+
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	if page <= 0 {
+		page = 1
+	}
+	pageURL := recentURL(r, filters, page, "")
+
+	if r.Method == http.MethodPost {
+		editRecentComments(w, r, pageURL)
+		return
+	}
+
+	v := map[string]interface{}{
+		"Thread":  filters.Get("thread"),
+		"Name":    filters.Get("name"),
+		"Email":   filters.Get("email"),
+		"From":    filters.Get("from"),
+		"To":      filters.Get("to"),
+		"PageURL": pageURL,
+		"Error":   err,
+	}
+	if err != nil {
+		render.Template(w, r, "admin/comments-recent", v)
+		return
+	}
+
+	results, more, err := comments.Search(query, (page-1)*RecentPerPage, RecentPerPage)
+	if err != nil {
+		log.Error("Couldn't search the comments: %s", err)
+		v["Error"] = err
+	}
+
+	editing := r.FormValue("edit")
+	rows := []recentComment{}
+	for _, c := range results {
+		key := c.ThreadID + ":" + c.ID
+		c.HTML = template.HTML(markdown.RenderMarkdown(c.Body))
+		c.LoadAvatar()
+		c.Editing = key == editing
+		rows = append(rows, recentComment{
+			Comment: c,
+			Key:     key,
+			EditURL: recentURL(r, filters, page, key),
+		})
+	}
+	v["Comments"] = rows
+
+	if page > 1 {
+		v["PreviousURL"] = recentURL(r, filters, page-1, "")
+	}
+	if more {
+		v["NextURL"] = recentURL(r, filters, page+1, "")
+	}
+
+	render.Template(w, r, "admin/comments-recent", v)
+}
+
+// editRecentComments handles the save, delete and bulk delete buttons of the
+// recent comments page, then goes back to the page it was on.
+func editRecentComments(w http.ResponseWriter, r *http.Request, pageURL string) {
+	switch {
+	case r.FormValue("save") != "":
+		threadID, id := splitCommentKey(r.FormValue("save"))
+		body := strings.TrimSpace(r.FormValue("body"))
+		if body == "" {
+			responses.FlashAndRedirect(w, r, pageURL, "The comment can't be empty.")
+			return
+		}
+
+		t := comments.New(threadID)
+		if err := t.Edit(id, body); err != nil {
+			responses.FlashAndRedirect(w, r, pageURL, "Error saving the comment: %s", err)
+			return
+		}
+		responses.FlashAndRedirect(w, r, pageURL, "Comment updated.")
+	case r.FormValue("delete") != "":
+		threadID, id := splitCommentKey(r.FormValue("delete"))
+		t := comments.New(threadID)
+		if err := t.Delete(id); err != nil {
+			responses.FlashAndRedirect(w, r, pageURL, "Error deleting the comment: %s", err)
+			return
+		}
+		responses.FlashAndRedirect(w, r, pageURL, "Comment deleted.")
+	case r.FormValue("action") == "bulk-delete":
+		var deleted int
+		for _, key := range r.Form["select"] {
+			threadID, id := splitCommentKey(key)
+			t := comments.New(threadID)
+			if err := t.Delete(id); err != nil {
+				log.Error("Couldn't delete comment %s: %s", key, err)
+				continue
+			}
+			deleted++
+		}
+		responses.FlashAndRedirect(w, r, pageURL, "Deleted %d comment(s).", deleted)
+	default:
+		responses.FlashAndRedirect(w, r, pageURL, "Unknown action.")
+	}
+}
+
+// recentQuery reads the filters of the recent comments page. The date range
+// is from the start of the "from" day to the end of the "to" day.
+func recentQuery(r *http.Request) (comments.Query, url.Values, error) {
+	var (
+		q       comments.Query
+		filters = url.Values{}
+		err     error
+	)
+	for _, name := range []string{"thread", "name", "email", "from", "to"} {
+		if value := strings.TrimSpace(r.FormValue(name)); value != "" {
+			filters.Set(name, value)
+		}
+	}
+
+	q.ThreadID = filters.Get("thread")
+	q.Name = filters.Get("name")
+	q.Email = filters.Get("email")
+	if from := filters.Get("from"); from != "" {
+		if q.After, err = time.ParseInLocation("2006-01-02", from, time.Local); err != nil {
+			return q, filters, err
+		}
+	}
+	if to := filters.Get("to"); to != "" {
+		if q.Before, err = time.ParseInLocation("2006-01-02", to, time.Local); err != nil {
+			return q, filters, err
+		}
+		q.Before = q.Before.AddDate(0, 0, 1)
+	}
+	return q, filters, nil
+}
+
+// recentURL links to a page of the recent comments with the same filters,
+// optionally editing one of the comments.
+func recentURL(r *http.Request, filters url.Values, page int, edit string) string {
+	query := url.Values{}
+	for name, values := range filters {
+		query[name] = values
+	}
+	if page > 1 {
+		query.Set("page", strconv.Itoa(page))
+	}
+	if edit != "" {
+		query.Set("edit", edit)
+	}
+
+	if len(query) == 0 {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// splitCommentKey splits a "thread:id" key from the recent comments form.
+// Thread IDs may have colons of their own, so it splits at the last one.
+func splitCommentKey(key string) (threadID, id string) {
+	i := strings.LastIndex(key, ":")
+	if i < 0 {
+		return key, ""
+	}
+	return key[:i], key[i+1:]
+}
@@ -3,6 +3,7 @@ package admin
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/kirsle/blog/src/forms"
 	"github.com/kirsle/blog/src/render"
@@ -23,6 +24,12 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 		mailPort, _ := strconv.Atoi(r.FormValue("mail-port"))
 		ppp, _ := strconv.Atoi(r.FormValue("posts-per-page"))
 		ppf, _ := strconv.Atoi(r.FormValue("posts-per-feed"))
+		maxKeys, _ := strconv.Atoi(r.FormValue("cache-max-keys"))
+		maxDepth, _ := strconv.Atoi(r.FormValue("comment-max-depth"))
+		maxLinks, _ := strconv.Atoi(r.FormValue("spam-max-links"))
+		ipRate, _ := strconv.Atoi(r.FormValue("spam-ip-rate"))
+		emailRate, _ := strconv.Atoi(r.FormValue("spam-email-rate"))
+		blocklist := lines(r.FormValue("spam-blocklist"))
 		form := &forms.Settings{
 			Title:        r.FormValue("title"),
 			Description:  r.FormValue("description"),
@@ -31,11 +38,22 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 			NSFW:         r.FormValue("nsfw") == "true",
 			PostsPerPage: ppp,
 			PostsPerFeed: ppf,
+			Moderation:   r.FormValue("comment-moderation"),
+			MaxDepth:     maxDepth,
+			MaxLinks:     maxLinks,
+			Blocklist:    blocklist,
+			IPRate:       ipRate,
+			EmailRate:    emailRate,
+			Classifier:   len(r.FormValue("spam-classifier")) > 0,
+			Proxies:      lines(r.FormValue("trusted-proxies")),
 			RedisEnabled: len(r.FormValue("redis-enabled")) > 0,
 			RedisHost:    r.FormValue("redis-host"),
 			RedisPort:    redisPort,
 			RedisDB:      redisDB,
 			RedisPrefix:  r.FormValue("redis-prefix"),
+			WatchFiles:   len(r.FormValue("watch-files")) > 0,
+			MemoryCache:  len(r.FormValue("memory-cache")) > 0,
+			MaxKeys:      maxKeys,
 			MailEnabled:  len(r.FormValue("mail-enabled")) > 0,
 			MailSender:   r.FormValue("mail-sender"),
 			MailHost:     r.FormValue("mail-host"),
@@ -53,11 +71,22 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 		settings.Site.NSFW = form.NSFW
 		settings.Blog.PostsPerPage = form.PostsPerPage
 		settings.Blog.PostsPerFeed = form.PostsPerFeed
+		settings.Comments.Moderation = form.Moderation
+		settings.Comments.MaxDepth = form.MaxDepth
+		settings.Spam.MaxLinks = form.MaxLinks
+		settings.Spam.Blocklist = form.Blocklist
+		settings.Spam.IPRate = form.IPRate
+		settings.Spam.EmailRate = form.EmailRate
+		settings.Spam.Classifier = form.Classifier
+		settings.Security.TrustedProxies = form.Proxies
 		settings.Redis.Enabled = form.RedisEnabled
 		settings.Redis.Host = form.RedisHost
 		settings.Redis.Port = form.RedisPort
 		settings.Redis.DB = form.RedisDB
 		settings.Redis.Prefix = form.RedisPrefix
+		settings.Cache.WatchFiles = form.WatchFiles
+		settings.Cache.Memory = form.MemoryCache
+		settings.Cache.MaxKeys = form.MaxKeys
 		settings.Mail.Enabled = form.MailEnabled
 		settings.Mail.Sender = form.MailSender
 		settings.Mail.Host = form.MailHost
@@ -78,3 +107,14 @@ func settingsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	render.Template(w, r, "admin/settings", v)
 }
+
+// lines splits the text of a textarea into its lines, without blank ones.
+func lines(text string) []string {
+	result := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
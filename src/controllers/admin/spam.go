@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+	"github.com/kirsle/blog/src/spam"
+)
+
+// spamHandler shows what the spam filters have caught, so the admin can train
+// the classifier by marking each one as spam or not.
+func spamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		trainSpam(w, r)
+		return
+	}
+
+	render.Template(w, r, "admin/spam", map[string]interface{}{
+		"Caught":      spam.LoadCaught().Items,
+		"Classifier":  spam.LoadClassifier(),
+		"MinTraining": spam.MinTraining,
+	})
+}
+
+// trainSpam handles the spam and not-spam buttons for caught submissions, and
+// the form to train the classifier with any text.
+func trainSpam(w http.ResponseWriter, r *http.Request) {
+	isSpam := r.FormValue("action") == "spam"
+	switch r.FormValue("action") {
+	case "spam", "ham":
+	default:
+		responses.FlashAndReload(w, r, "Unknown action.")
+		return
+	}
+
+	var submission *spam.Submission
+	if id := r.FormValue("id"); id != "" {
+		caught, err := spam.LoadCaught().Remove(id)
+		if err != nil {
+			responses.FlashAndReload(w, r, err.Error())
+			return
+		}
+		submission = caught.Submission()
+	} else if text := r.FormValue("text"); text != "" {
+		submission = &spam.Submission{Body: text}
+	} else {
+		responses.FlashAndReload(w, r, "There was nothing to train the classifier with.")
+		return
+	}
+
+	if err := spam.Train(submission, isSpam); err != nil {
+		responses.FlashAndReload(w, r, "Error training the classifier: %s", err)
+		return
+	}
+
+	if isSpam {
+		responses.FlashAndReload(w, r, "Marked as spam.")
+	} else {
+		responses.FlashAndReload(w, r, "Marked as not spam.")
+	}
+}
@@ -11,8 +11,10 @@ import (
 	"github.com/kirsle/blog/src/log"
 	"github.com/kirsle/blog/src/mail"
 	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/middleware"
 	"github.com/kirsle/blog/src/middleware/auth"
 	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/settings"
 	"github.com/kirsle/blog/models/users"
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/src/responses"
@@ -27,6 +29,7 @@ func Register(r *mux.Router) {
 	render.Funcs["RenderComments"] = RenderComments
 
 	r.HandleFunc("/comments", commentHandler)
+	r.HandleFunc("/comments.{format:rss|atom|json}", feedHandler)
 	r.HandleFunc("/comments/subscription", subscriptionHandler)
 	r.HandleFunc("/comments/quick-delete", quickDeleteHandler)
 }
@@ -38,6 +41,10 @@ type CommentMeta struct {
 	OriginURL  string // URL where original comment thread appeared
 	Subject    string // email subject
 	Thread     *comments.Thread
+	Comments   []*comments.Comment // top-level comments, with their replies
+	Count      int                 // number of comments shown, not counting deleted ones
+	Threaded   bool                // whether replies are turned on
+	ReplyTo    *comments.Comment   // the comment the form is replying to
 	Authors    map[int]*users.User
 	CSRF       string
 }
@@ -71,12 +78,36 @@ func RenderComments(r *http.Request, subject string, ids ...string) template.HTM
 		thread = comments.New(id)
 	}
 
-	// Render all the comments in the thread.
+	maxDepth := commentMaxDepth()
+	threaded := maxDepth > 1
+	replyID := r.FormValue("reply")
+
+	// Render all the comments in the thread. Comments waiting for moderation
+	// are only shown to admins and to the person who posted them.
 	userMap := map[int]*users.User{}
+	visible := []*comments.Comment{}
+	var (
+		count   int
+		replyTo *comments.Comment
+	)
 	for _, c := range thread.Comments {
-		c.HTML = template.HTML(markdown.RenderMarkdown(c.Body))
+		if c.IsPending() && !isAdmin && (c.EditToken == "" || c.EditToken != editToken) {
+			continue
+		}
+		visible = append(visible, c)
+
 		c.ThreadID = thread.ID
 		c.OriginURL = url
+		if c.Deleted {
+			continue
+		}
+		count++
+		c.CanReply = threaded
+		if threaded && c.ID == replyID {
+			replyTo = c
+		}
+
+		c.HTML = template.HTML(markdown.RenderMarkdown(c.Body))
 		c.CSRF = csrf
 
 		// Look up the author username.
@@ -100,6 +131,7 @@ func RenderComments(r *http.Request, subject string, ids ...string) template.HTM
 			c.Editable = true
 		}
 	}
+	thread.Comments = visible
 
 	// Get the template snippet.
 	filepath, err := render.ResolvePath("comments/comments.partial")
@@ -128,6 +160,10 @@ func RenderComments(r *http.Request, subject string, ids ...string) template.HTM
 		Subject:   subject,
 		CSRF:      csrf,
 		Thread:    &thread,
+		Comments:  thread.Tree(maxDepth),
+		Count:     count,
+		Threaded:  threaded,
+		ReplyTo:   replyTo,
 		NewComment: comments.Comment{
 			Name:            name,
 			Email:           email,
@@ -217,7 +253,19 @@ func commentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		c.HTML = template.HTML(markdown.RenderMarkdown(c.Body))
 	case "post":
-		if err := c.Validate(); err != nil {
+		// Log where new comments came from, to trace abuse.
+		if !c.Editing {
+			c.IP = middleware.RemoteAddr(r)
+			c.UserAgent = r.UserAgent()
+		}
+
+		var held bool
+		err := c.Validate()
+		if err == nil {
+			held, err = screen(r, c, currentUser)
+		}
+
+		if err != nil {
 			v["Error"] = err
 		} else {
 			// Store our edit token, if we don't have one. For example, admins
@@ -231,13 +279,32 @@ func commentHandler(w http.ResponseWriter, r *http.Request) {
 				c.UserID = currentUser.ID
 			}
 
+			// New comments may have to wait for a moderator, and replies
+			// nested too deeply go alongside the comment they replied to.
+			if !c.Editing {
+				c.Status = moderationStatus(c, currentUser)
+				c.ParentID = t.ReplyTo(c.ParentID, commentMaxDepth())
+			}
+
+			// Banned commenters are held quietly, if they aren't turned away.
+			if held {
+				c.Status = comments.StatusPending
+			}
+
 			// Append their comment.
 			err := t.Post(c)
 			if err != nil {
 				responses.FlashAndRedirect(w, r, c.OriginURL, "Error posting comment: %s", err)
 				return
 			}
-			mail.NotifyComment(c)
+			if !held {
+				mail.NotifyComment(c)
+			}
+
+			message := "Comment posted!"
+			if c.IsPending() {
+				message = "Your comment will appear once a moderator approves it."
+			}
 
 			// Are they subscribing to future comments?
 			if c.Subscribe && len(c.Email) > 0 {
@@ -245,13 +312,13 @@ func commentHandler(w http.ResponseWriter, r *http.Request) {
 					m := comments.LoadMailingList()
 					m.Subscribe(t.ID, c.Email)
 					responses.FlashAndRedirect(w, r, c.OriginURL,
-						"Comment posted, and you've been subscribed to "+
+						message+" You've been subscribed to "+
 							"future comments on this page.",
 					)
 					return
 				}
 			}
-			responses.FlashAndRedirect(w, r, c.OriginURL, "Comment posted!")
+			responses.FlashAndRedirect(w, r, c.OriginURL, message)
 			log.Info("t: %v", t.Comments)
 			return
 		}
@@ -286,6 +353,15 @@ func quickDeleteHandler(w http.ResponseWriter, r *http.Request) {
 	responses.FlashAndRedirect(w, r, "/", "Comment deleted!")
 }
 
+// commentMaxDepth returns how deeply replies are nested on this site.
+func commentMaxDepth() int {
+	s, err := settings.Load()
+	if err != nil || s.Comments.MaxDepth < 1 {
+		return settings.DefaultMaxDepth
+	}
+	return s.Comments.MaxDepth
+}
+
 // getEditToken gets or generates an edit token from the user's session, which
 // allows a user to edit their comment for a short while after they post it.
 func getEditToken(w http.ResponseWriter, r *http.Request) string {
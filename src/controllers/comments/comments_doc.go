@@ -6,6 +6,7 @@ Routes
 	/comments               Main comment handler
 	/comments/subscription  Manage subscription to comment threads
 	/comments/quick-delete  Quickly delete spam comments from admin email
+	/comments.rss           Feed of recent comments site-wide (also .atom, .json)
 
 Related Models
 
@@ -21,10 +22,52 @@ custom pages, etc.
 Every comment thread has a unique ID, so some automated threads have name spaces,
 like "blog-$id".
 
+Each thread remembers the URL and title of the page it was posted on, which the
+site-wide comments feed links back to. Comments on blog posts that the reader
+couldn't see in the blog listings are left out of the feed.
+
+Moderation
+
+The site settings choose whether new comments are held for a moderator: all of
+them, only those from people who haven't had a comment approved before (by
+email address), or none. Comments from logged-in users are never held. A held
+comment is only shown to the admins and to whoever posted it (by their edit
+token), and it's left out of comment counts and the feed until it's approved
+in the queue at /admin/comments. Banning a commenter from there rejects all of
+their pending comments and adds their email and IP address to the ban list.
+
+The ban list, edited at /admin/blocklist, has email addresses, IP addresses
+and CIDR ranges, and also covers the contact form and questions. It either
+turns banned people away with an error, or quietly holds their comments for
+moderation without emailing anybody about them. Each comment records the IP
+address and user agent it was posted from; behind a reverse proxy, list the
+proxy in the settings so the X-Forwarded-For header it sends is believed.
+
+New comments from visitors who aren't logged in also go through the spam
+filters (see the spam package), which turn them away with an error instead of
+holding them. Approving a comment or rejecting it as spam from the queue
+trains the spam classifier.
+
+Every comment on the site, approved or pending, can be found from
+/admin/comments/recent, newest first, and filtered by thread, name, email and
+the dates it was posted. They're edited or deleted from there one at a time,
+or deleted in bulk. The page searches the JsonDB indexes on the comment
+threads instead of loading every thread.
+
+Replies
+
+Comments can be replied to, and the replies are shown nested under them up to
+the depth chosen in the site settings; replies to the deepest comments are
+shown alongside them instead. A depth of 1 turns replies off. Deleting a
+comment that has replies leaves a "[deleted]" placeholder in its place so the
+replies keep their context, and the placeholder goes away with the last reply.
+
 Subscriptions
 
 When users leave a comment with their e-mail address, they may opt in to getting
-notified about future comments left on the same thread.
+notified about future comments left on the same thread. Subscribers hear about a
+held comment only after it's approved. The author of a comment is emailed when
+somebody replies to it, even if they didn't subscribe to the thread.
 
 Go Template Function
 
@@ -0,0 +1,101 @@
+package comments
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/feeds"
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/settings"
+	postctl "github.com/kirsle/blog/src/controllers/posts"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// feedHandler serves the feed of the most recent comments across the site.
+func feedHandler(w http.ResponseWriter, r *http.Request) {
+	feed, err := postctl.NewFeed("Recent Comments", "")
+	if err != nil {
+		responses.Error(w, r, "Blog isn't ready yet.")
+		return
+	}
+
+	recent, err := comments.Recent()
+	if err != nil {
+		log.Error("Comments feed: %s", err)
+	}
+
+	var (
+		config, _ = settings.Load()
+		limit     = postctl.FeedLimit()
+		origins   = map[string]origin{}
+	)
+	for _, c := range recent {
+		if c.IsPending() {
+			continue
+		}
+
+		o, seen := origins[c.ThreadID]
+		if !seen {
+			o = threadOrigin(r, c)
+			origins[c.ThreadID] = o
+		}
+		if !o.Visible {
+			continue
+		}
+
+		name := c.Name
+		if name == "" {
+			name = "Anonymous"
+		}
+		title := "Comment by " + name
+		if o.Subject != "" {
+			title += " on " + o.Subject
+		}
+
+		feed.Items = append(feed.Items, &feeds.Item{
+			Id:          c.ID,
+			Title:       title,
+			Link:        &feeds.Link{Href: config.Site.URL + o.URL + "#comments"},
+			Author:      &feeds.Author{Name: name},
+			Description: postctl.AbsoluteLinks(markdown.RenderMarkdown(c.Body), config.Site.URL),
+			Created:     c.Created,
+		})
+		if len(feed.Items) == limit {
+			break
+		}
+	}
+
+	responses.Feed(w, r, feed)
+}
+
+// origin is where a comment thread appears on the site.
+type origin struct {
+	Subject string
+	URL     string
+	Visible bool
+}
+
+// threadOrigin finds the title and URL of the page a comment was posted on.
+// Comments on blog posts are only shown if the post itself would be.
+func threadOrigin(r *http.Request, c *comments.Comment) origin {
+	if strings.HasPrefix(c.ThreadID, "post-") {
+		id, err := strconv.Atoi(strings.TrimPrefix(c.ThreadID, "post-"))
+		if err != nil {
+			return origin{}
+		}
+		post, err := posts.Load(id)
+		if err != nil || !postctl.Visible(r, post.Privacy) {
+			return origin{}
+		}
+		return origin{post.Title, "/" + post.Fragment, true}
+	}
+
+	if c.OriginURL == "" {
+		return origin{c.Subject, "/", true}
+	}
+	return origin{c.Subject, c.OriginURL, true}
+}
@@ -0,0 +1,62 @@
+package comments
+
+import (
+	"net/http"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/models/users"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/spam"
+)
+
+// moderationStatus decides whether a new comment goes up right away or waits
+// for a moderator, following the site's settings. Comments from logged-in
+// users are always approved.
+func moderationStatus(c *comments.Comment, user *users.User) string {
+	if user.IsAuthenticated {
+		return comments.StatusApproved
+	}
+
+	s, err := settings.Load()
+	if err != nil {
+		s = settings.Defaults()
+	}
+
+	switch s.Comments.Moderation {
+	case settings.ModerateAll:
+		return comments.StatusPending
+	case settings.ModerateNew:
+		known, err := comments.HasApproved(c.Email)
+		if err != nil {
+			log.Error("Couldn't look for earlier comments by %s: %s", c.Email, err)
+		}
+		if known {
+			return comments.StatusApproved
+		}
+		return comments.StatusPending
+	}
+	return comments.StatusApproved
+}
+
+// screen checks a comment against the ban list and the spam filters,
+// returning whether it should be held quietly. Only comments from admins
+// aren't checked.
+//
+// Edits are checked too, since an approved comment could be edited into spam.
+// An edit isn't turned away, though: if it fails, it's held, and the comment
+// goes back to waiting for a moderator.
+func screen(r *http.Request, c *comments.Comment, user *users.User) (held bool, err error) {
+	if user.Admin {
+		return false, nil
+	}
+
+	s := spam.NewSubmission(r, spam.Comment, c.Name, c.Email, c.Body)
+	if !c.Editing {
+		return spam.Screen(s)
+	}
+
+	s.Edit = true
+	held, err = spam.Screen(s)
+	return held || err != nil, nil
+}
@@ -13,8 +13,11 @@ import (
 	"github.com/kirsle/blog/src/log"
 	"github.com/kirsle/blog/src/mail"
 	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/middleware"
+	"github.com/kirsle/blog/src/middleware/auth"
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/src/responses"
+	"github.com/kirsle/blog/src/spam"
 	"github.com/kirsle/blog/models/settings"
 )
 
@@ -49,7 +52,19 @@ func Register(r *mux.Router) {
 		// Posting?
 		if r.Method == http.MethodPost {
 			form.ParseForm(r)
-			if err = form.Validate(); err != nil {
+			form.IP = middleware.RemoteAddr(r)
+			form.UserAgent = r.UserAgent()
+			err = form.Validate()
+
+			// Messages from visitors are checked against the ban list and
+			// the spam filters.
+			if user, _ := auth.CurrentUser(r); err == nil && !user.IsAuthenticated {
+				form.Held, err = spam.Screen(spam.NewSubmission(r, spam.Contact,
+					form.Name, form.Email, form.Subject+"\n\n"+form.Message,
+				))
+			}
+
+			if err != nil {
 				// If they're not from the /contact front-end, redirect them
 				// with the flash.
 				if len(nextURL) > 0 {
@@ -61,18 +76,23 @@ func Register(r *mux.Router) {
 				// their form fields so far.
 				responses.Flash(w, r, err.Error())
 			} else {
-				go mail.SendEmail(mail.Email{
-					To:       cfg.Site.AdminEmail,
-					Admin:    true,
-					ReplyTo:  form.Email,
-					Subject:  fmt.Sprintf("Contact Form on %s: %s", cfg.Site.Title, form.Subject),
-					Template: ".email/contact.gohtml",
-					Data: map[string]interface{}{
-						"Name":    form.Name,
-						"Message": template.HTML(markdown.RenderMarkdown(form.Message)),
-						"Email":   form.Email,
-					},
-				})
+				// Messages from banned senders are only logged.
+				if !form.Held {
+					go mail.SendEmail(mail.Email{
+						To:       cfg.Site.AdminEmail,
+						Admin:    true,
+						ReplyTo:  form.Email,
+						Subject:  fmt.Sprintf("Contact Form on %s: %s", cfg.Site.Title, form.Subject),
+						Template: ".email/contact.gohtml",
+						Data: map[string]interface{}{
+							"Name":      form.Name,
+							"Message":   template.HTML(markdown.RenderMarkdown(form.Message)),
+							"Email":     form.Email,
+							"IP":        form.IP,
+							"UserAgent": form.UserAgent,
+						},
+					})
+				}
 
 				// Log it to disk, too.
 				fh, err := os.OpenFile(filepath.Join(*render.UserRoot, ".contact.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
@@ -80,10 +100,13 @@ func Register(r *mux.Router) {
 					responses.Flash(w, r, "Error logging the message to disk: %s", err)
 				} else {
 					fh.WriteString(fmt.Sprintf(
-						"Date: %s\nName: %s\nEmail: %s\nSubject: %s\n\n%s\n\n--------------------\n\n",
+						"Date: %s\nName: %s\nEmail: %s\nIP: %s\nUser-Agent: %s\nHeld: %v\nSubject: %s\n\n%s\n\n--------------------\n\n",
 						time.Now().Format(time.UnixDate),
 						form.Name,
 						form.Email,
+						form.IP,
+						form.UserAgent,
+						form.Held,
 						form.Subject,
 						form.Message,
 					))
@@ -6,10 +6,8 @@ import (
 	"time"
 
 	"github.com/kirsle/blog/models/posts"
-	"github.com/kirsle/blog/src/middleware/auth"
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/src/responses"
-	"github.com/kirsle/blog/src/types"
 )
 
 // archiveHandler summarizes all blog entries in an archive view.
@@ -25,9 +23,7 @@ func archiveHandler(w http.ResponseWriter, r *http.Request) {
 	byMonth := map[string]*Archive{}
 	for _, post := range idx.Posts {
 		// Exclude certain posts
-		if (post.Privacy == types.PRIVATE || post.Privacy == types.UNLISTED) && !auth.LoggedIn(r) {
-			continue
-		} else if post.Privacy == types.DRAFT {
+		if !Visible(r, post.Privacy) {
 			continue
 		}
 
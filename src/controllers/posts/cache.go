@@ -0,0 +1,151 @@
+package postctl
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/src/middleware/auth"
+	"github.com/kirsle/blog/src/sessions"
+)
+
+// maxCachedFeeds caps how many rendered feeds are kept in memory. Anyone can
+// ask for the feed of any tag, so the cache starts over when it fills up.
+const maxCachedFeeds = 100
+
+// cachedFeed is a rendered feed, ready to send again.
+type cachedFeed struct {
+	ETag        string
+	ContentType string
+	Body        []byte
+}
+
+// The feed cache, and what's needed to tell when it goes stale. Saving a post
+// from the editor without touching its Updated time still changes the
+// generation, and with it every ETag, so readers don't miss the edit.
+var (
+	feedCache   = map[string]cachedFeed{}
+	feedCacheMu sync.Mutex
+	startedAt   = time.Now().UnixNano()
+	generation  int
+	lastChange  time.Time
+)
+
+// postsChanged empties the feed cache when a post is saved or deleted.
+func postsChanged(p *posts.Post) {
+	feedCacheMu.Lock()
+	defer feedCacheMu.Unlock()
+	feedCache = map[string]cachedFeed{}
+	generation++
+	lastChange = time.Now().UTC()
+}
+
+// getCachedFeed returns the rendered feed for a key if it has the same ETag.
+func getCachedFeed(key, etag string) (cachedFeed, bool) {
+	feedCacheMu.Lock()
+	defer feedCacheMu.Unlock()
+	feed, ok := feedCache[key]
+	return feed, ok && feed.ETag == etag
+}
+
+// setCachedFeed stores a rendered feed.
+func setCachedFeed(key string, feed cachedFeed) {
+	feedCacheMu.Lock()
+	defer feedCacheMu.Unlock()
+	if len(feedCache) >= maxCachedFeeds {
+		feedCache = map[string]cachedFeed{}
+	}
+	feedCache[key] = feed
+}
+
+// blogVersion returns the parts of an ETag and Last-Modified time that change
+// whenever any post does.
+func blogVersion(idx *posts.Index) (string, time.Time) {
+	feedCacheMu.Lock()
+	defer feedCacheMu.Unlock()
+
+	modified := idx.LastModified()
+	if lastChange.After(modified) {
+		modified = lastChange
+	}
+	return fmt.Sprintf("%x.%d.%s", startedAt, generation, idx.Fingerprint()), modified
+}
+
+// audience is whether a request sees only public posts in the listings, or
+// the private and unlisted ones too.
+func audience(r *http.Request) string {
+	if auth.LoggedIn(r) {
+		return "private"
+	}
+	return "public"
+}
+
+// cacheControl sets the Cache-Control header so browsers and proxies check
+// back with the validators before reusing a response.
+func cacheControl(w http.ResponseWriter, r *http.Request) {
+	if auth.LoggedIn(r) {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+}
+
+// makeETag hashes its parts into a quoted ETag.
+func makeETag(parts ...interface{}) string {
+	h := sha1.New()
+	for _, part := range parts {
+		fmt.Fprintf(h, "%v\n", part)
+	}
+
+	// The site settings show up in every page and feed.
+	if config, err := settings.Load(); err == nil {
+		fmt.Fprintf(h, "%v\n%v\n", config.Site, config.Blog)
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+// viewerVersion identifies the parts of the session that go into a rendered
+// page: who's logged in, the CSRF token in its forms and the name and email
+// remembered for the comment form.
+func viewerVersion(r *http.Request) string {
+	session := sessions.Get(r)
+	return fmt.Sprintf("%v|%v|%v|%v|%v|%v",
+		session.Values["logged-in"],
+		session.Values["user-id"],
+		session.Values["csrf"],
+		session.Values["c.token"],
+		session.Values["c.name"],
+		session.Values["c.email"],
+	)
+}
+
+// hasFlashes returns whether the session has flash messages waiting to be
+// shown, which a cached copy of the page wouldn't have.
+func hasFlashes(r *http.Request) bool {
+	flashes, _ := sessions.Get(r).Values["_flash"].([]interface{})
+	return len(flashes) > 0
+}
+
+// commentsVersion returns the parts of an ETag and Last-Modified time that
+// change with the comments on a post.
+func commentsVersion(p *posts.Post) (string, time.Time) {
+	thread, err := comments.Load(fmt.Sprintf("post-%d", p.ID))
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	var newest time.Time
+	for _, c := range thread.Comments {
+		if c.Updated.After(newest) {
+			newest = c.Updated
+		}
+	}
+	return fmt.Sprintf("%d.%d", len(thread.Comments), newest.UnixNano()), newest
+}
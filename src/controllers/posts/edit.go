@@ -65,11 +65,20 @@ func editHandler(w http.ResponseWriter, r *http.Request) {
 					post.Updated = time.Now().UTC()
 				}
 				err = post.Save()
+				if err == nil {
+					err = updateSeries(r, post)
+				}
 
 				if err != nil {
 					v["Error"] = err
 				} else {
-					responses.Flash(w, r, "Post created!")
+					if post.IsScheduled() {
+						responses.Flash(w, r, "Post scheduled for %s.",
+							post.PublishAt.Local().Format("Jan 2 2006 @ 15:04 MST"),
+						)
+					} else {
+						responses.Flash(w, r, "Post created!")
+					}
 					responses.Redirect(w, "/"+post.Fragment)
 				}
 			}
@@ -77,6 +86,7 @@ func editHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	v["post"] = post
+	seriesFormValues(r, post, v)
 	render.Template(w, r, "blog/edit", v)
 }
 
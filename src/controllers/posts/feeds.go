@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gorilla/feeds"
+	"github.com/gorilla/mux"
 	"github.com/kirsle/blog/models/posts"
 	"github.com/kirsle/blog/models/settings"
 	"github.com/kirsle/blog/models/users"
@@ -16,35 +17,117 @@ import (
 	"github.com/kirsle/blog/src/types"
 )
 
-// Feed configuration. TODO make configurable.
-var (
-	FeedPostsPerPage = 20
-
-	reRelativeLink = regexp.MustCompile(` (src|href|poster)=(['"])/([^'"]+)['"]`)
-)
+var reRelativeLink = regexp.MustCompile(` (src|href|poster)=(['"])/([^'"]+)['"]`)
 
+// feedHandler serves the feed of the whole blog.
 func feedHandler(w http.ResponseWriter, r *http.Request) {
+	postsFeed(w, r, "", "", "", nil)
+}
+
+// tagFeedHandler serves the feed of the posts with a tag.
+func tagFeedHandler(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	postsFeed(w, r, "Tagged as: "+tag, "/tagged/"+tag, tag, nil)
+}
+
+// authorFeedHandler serves the feed of the posts by one author.
+func authorFeedHandler(w http.ResponseWriter, r *http.Request) {
+	author, err := users.LoadUsername(mux.Vars(r)["username"])
+	if err != nil {
+		responses.NotFound(w, r, "That user was not found.")
+		return
+	}
+
+	name := author.Name
+	if name == "" {
+		name = author.Username
+	}
+	postsFeed(w, r, "Posts by "+name, "/blog", "", func(p posts.Post) bool {
+		return p.AuthorID == author.ID
+	})
+}
+
+// NewFeed starts a feed for the site. The title and link, when given, narrow
+// it down from the whole site to a part of it.
+func NewFeed(title, link string) (*feeds.Feed, error) {
 	config, _ := settings.Load()
 	admin, err := users.Load(1)
 	if err != nil {
-		responses.Error(w, r, "Blog isn't ready yet.")
-		return
+		return nil, err
 	}
 
-	feed := &feeds.Feed{
-		Title:       config.Site.Title,
-		Link:        &feeds.Link{Href: config.Site.URL},
+	if title == "" {
+		title = config.Site.Title
+	} else {
+		title = config.Site.Title + ": " + title
+	}
+
+	return &feeds.Feed{
+		Title:       title,
+		Link:        &feeds.Link{Href: config.Site.URL + link},
 		Description: config.Site.Description,
 		Author: &feeds.Author{
 			Name:  admin.Name,
 			Email: admin.Email,
 		},
 		Created: time.Now(),
+		Items:   []*feeds.Item{},
+	}, nil
+}
+
+// FeedLimit returns how many items to put in a feed.
+func FeedLimit() int {
+	config, _ := settings.Load()
+	if config.Blog.PostsPerFeed > 0 {
+		return config.Blog.PostsPerFeed
+	}
+	return settings.Defaults().Blog.PostsPerFeed
+}
+
+// postsFeed serves a feed of the most recent blog posts with the tag, if
+// given, and that the filter function allows, if given.
+//
+// Feed readers poll these constantly, so they get ETag and Last-Modified
+// validators, and the rendered feeds are cached until a post changes.
+func postsFeed(w http.ResponseWriter, r *http.Request, title, link, tag string, filter func(posts.Post) bool) {
+	idx, err := posts.GetIndex()
+	if err != nil {
+		responses.Error(w, r, "Blog isn't ready yet.")
+		return
+	}
+
+	var (
+		key              = r.URL.Path + "|" + audience(r)
+		version, updated = blogVersion(idx)
+		etag             = makeETag(key, title, version)
+	)
+	cacheControl(w, r)
+	if responses.NotModified(w, r, etag, updated) {
+		return
 	}
+	if cached, ok := getCachedFeed(key, etag); ok {
+		w.Header().Set("Content-Type", cached.ContentType)
+		w.Write(cached.Body)
+		return
+	}
+
+	feed, err := NewFeed(title, link)
+	if err != nil {
+		responses.Error(w, r, "Blog isn't ready yet.")
+		return
+	}
+
+	config, _ := settings.Load()
+	limit := FeedLimit()
+	for _, p := range RecentPosts(r, tag, "") {
+		if filter != nil && !filter(p) {
+			continue
+		}
 
-	feed.Items = []*feeds.Item{}
-	for i, p := range RecentPosts(r, "", "") {
-		post, _ := posts.Load(p.ID)
+		post, err := posts.Load(p.ID)
+		if err != nil {
+			continue
+		}
 
 		// Render the post to HTML.
 		var rendered string
@@ -54,45 +137,48 @@ func feedHandler(w http.ResponseWriter, r *http.Request) {
 			rendered = post.Body
 		}
 
-		// Make relative links absolute.
-		matches := reRelativeLink.FindAllStringSubmatch(rendered, -1)
-		for _, match := range matches {
-			var (
-				attr   = match[1]
-				quote  = match[2]
-				uri    = match[3]
-				absURI = config.Site.URL + "/" + uri
-				new    = fmt.Sprintf(" %s%s%s%s",
-					attr, quote, absURI, quote,
-				)
-			)
-			rendered = strings.Replace(rendered, match[0], new, 1)
-		}
-
 		feed.Items = append(feed.Items, &feeds.Item{
 			Id:          fmt.Sprintf("%d", p.ID),
 			Title:       p.Title,
 			Link:        &feeds.Link{Href: config.Site.URL + "/" + p.Fragment},
-			Description: rendered,
+			Description: AbsoluteLinks(rendered, config.Site.URL),
 			Created:     p.Created,
 		})
-		if i == FeedPostsPerPage-1 {
+		if len(feed.Items) == limit {
 			break
 		}
 	}
 
-	// What format to encode it in?
-	if strings.Contains(r.URL.Path, ".atom") {
-		atom, _ := feed.ToAtom()
-		w.Header().Set("Content-Type", "application/atom+xml; encoding=utf-8")
-		w.Write([]byte(atom))
-	} else if strings.Contains(r.URL.Path, ".json") {
-		jsonData, _ := feed.ToJSON()
-		w.Header().Set("Content-Type", "application/json; encoding=utf-8")
-		w.Write([]byte(jsonData))
-	} else {
-		rss, _ := feed.ToRss()
-		w.Header().Set("Content-Type", "application/rss+xml; encoding=utf-8")
-		w.Write([]byte(rss))
+	contentType, body, err := responses.EncodeFeed(r, feed)
+	if err != nil {
+		responses.Error(w, r, "Error encoding the feed: "+err.Error())
+		return
+	}
+	setCachedFeed(key, cachedFeed{
+		ETag:        etag,
+		ContentType: contentType,
+		Body:        body,
+	})
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// AbsoluteLinks makes the relative links in rendered HTML absolute, so they
+// work from a feed reader.
+func AbsoluteLinks(rendered, siteURL string) string {
+	matches := reRelativeLink.FindAllStringSubmatch(rendered, -1)
+	for _, match := range matches {
+		var (
+			attr   = match[1]
+			quote  = match[2]
+			uri    = match[3]
+			absURI = siteURL + "/" + uri
+			new    = fmt.Sprintf(" %s%s%s%s",
+				attr, quote, absURI, quote,
+			)
+		)
+		rendered = strings.Replace(rendered, match[0], new, 1)
 	}
+	return rendered
 }
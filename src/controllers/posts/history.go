@@ -0,0 +1,115 @@
+package postctl
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/users"
+	"github.com/kirsle/blog/src/diff"
+	"github.com/kirsle/blog/src/middleware/auth"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// historyHandler lists the revisions of a blog post, shows the differences
+// between two of them and restores old revisions.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		responses.FlashAndRedirect(w, r, "/admin", "No post ID given for the history!")
+		return
+	}
+
+	post, err := posts.Load(id)
+	if err != nil {
+		responses.FlashAndRedirect(w, r, "/admin", "That post ID was not found.")
+		return
+	}
+
+	historyURL := fmt.Sprintf("/blog/history?id=%d", id)
+
+	// Restoring a revision?
+	if r.Method == http.MethodPost {
+		rev, err := posts.LoadRevision(id, r.FormValue("revision"))
+		if err != nil {
+			responses.FlashAndRedirect(w, r, historyURL, "That revision was not found.")
+			return
+		}
+
+		author, _ := auth.CurrentUser(r)
+		restored, err := rev.Restore(author.ID)
+		if err != nil {
+			responses.FlashAndRedirect(w, r, historyURL, "Error restoring the revision: %s", err)
+			return
+		}
+
+		responses.FlashAndRedirect(w, r, "/"+restored.Fragment,
+			"Restored the revision from %s.", rev.Created.Format("Jan 2 2006 @ 15:04:05 MST"),
+		)
+		return
+	}
+
+	revisions, err := posts.Revisions(id)
+	if err != nil {
+		responses.FlashAndRedirect(w, r, "/"+post.Fragment, "Error loading the post history: %s", err)
+		return
+	}
+
+	// Look up the authors of each revision.
+	authors := map[int]*users.User{}
+	for _, rev := range revisions {
+		if _, ok := authors[rev.AuthorID]; !ok {
+			author, err := users.LoadReadonly(rev.AuthorID)
+			if err != nil {
+				author = users.DeletedUser()
+			}
+			authors[rev.AuthorID] = author
+		}
+	}
+
+	v := map[string]interface{}{
+		"Post":      post,
+		"Revisions": revisions,
+		"Authors":   authors,
+	}
+
+	// Comparing two revisions? The default is the two most recent.
+	a, b := r.FormValue("a"), r.FormValue("b")
+	if a == "" && b == "" && len(revisions) > 1 {
+		a, b = revisions[1].ID, revisions[0].ID
+	}
+	if a != "" && b != "" {
+		revA, errA := posts.LoadRevision(id, a)
+		revB, errB := posts.LoadRevision(id, b)
+		if errA != nil || errB != nil {
+			responses.FlashAndRedirect(w, r, historyURL, "That revision was not found.")
+			return
+		}
+
+		lines := diff.Lines(revisionText(revA), revisionText(revB))
+		v["A"] = revA
+		v["B"] = revB
+		v["Diff"] = lines
+		v["Changed"] = diff.Changed(lines)
+	}
+
+	render.Template(w, r, "blog/history", v)
+}
+
+// revisionText renders a revision as plain text for comparing, with its
+// metadata on top of the body.
+func revisionText(rev *posts.Revision) string {
+	p := rev.Post
+	var meta = []string{
+		"Title: " + p.Title,
+		"Fragment: " + p.Fragment,
+		"Tags: " + strings.Join(p.Tags, ", "),
+		"Privacy: " + p.Privacy,
+		"Content-Type: " + p.ContentType,
+		"",
+	}
+	return strings.Join(meta, "\n") + "\n" + p.Body
+}
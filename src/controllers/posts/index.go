@@ -73,7 +73,7 @@ func partialIndex(r *http.Request, tag, privacy string) template.HTML {
 		// Count the comments on this post.
 		var numComments int
 		if thread, err := comments.Load(fmt.Sprintf("post-%d", post.ID)); err == nil {
-			numComments = len(thread.Comments)
+			numComments = len(thread.Approved())
 		}
 
 		view = append(view, PostMeta{
@@ -0,0 +1,53 @@
+package postctl
+
+import (
+	"net/http"
+
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/src/log"
+)
+
+// RelatedPostsLimit is how many related posts are shown below a blog entry.
+var RelatedPostsLimit = 5
+
+// Neighbors finds the blog entries posted just before and after this one that
+// the current user is allowed to see. Either may be nil.
+func Neighbors(r *http.Request, p *posts.Post) (previous, next *posts.Post) {
+	idx, err := posts.GetIndex()
+	if err != nil {
+		log.Error("Neighbors: couldn't load the blog index: %s", err)
+		return nil, nil
+	}
+	return idx.Neighbors(p.ID, visibleTo(r))
+}
+
+// PreviousPost is the template function for the entry before this one.
+func PreviousPost(r *http.Request, p *posts.Post) *posts.Post {
+	previous, _ := Neighbors(r, p)
+	return previous
+}
+
+// NextPost is the template function for the entry after this one.
+func NextPost(r *http.Request, p *posts.Post) *posts.Post {
+	_, next := Neighbors(r, p)
+	return next
+}
+
+// RelatedPosts finds the blog entries that share the most tags with this one
+// that the current user is allowed to see.
+func RelatedPosts(r *http.Request, p *posts.Post) []posts.Post {
+	idx, err := posts.GetIndex()
+	if err != nil {
+		log.Error("RelatedPosts: couldn't load the blog index: %s", err)
+		return nil
+	}
+	return idx.Related(p.ID, RelatedPostsLimit, visibleTo(r))
+}
+
+// visibleTo filters the blog index by what shows up in listings for this
+// request.
+func visibleTo(r *http.Request) func(posts.Post) bool {
+	return func(p posts.Post) bool {
+		return Visible(r, p.Privacy)
+	}
+}
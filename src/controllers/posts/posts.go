@@ -43,15 +43,27 @@ func Register(r *mux.Router, loginError http.HandlerFunc) {
 	render.Funcs["RenderIndex"] = partialIndex
 	render.Funcs["RenderPost"] = partialPost
 	render.Funcs["RenderTags"] = partialTags
+	render.Funcs["PreviousPost"] = PreviousPost
+	render.Funcs["NextPost"] = NextPost
+	render.Funcs["RelatedPosts"] = RelatedPosts
+	render.Funcs["SeriesNav"] = SeriesNavFor
+
+	posts.OnPublish(func(p *posts.Post) {
+		log.Info("Blog post %d is now public: %s", p.ID, p.Title)
+	})
+	posts.OnChange(postsChanged)
 
 	// Public routes
 	r.HandleFunc("/blog", indexHandler)
 	r.HandleFunc("/blog.rss", feedHandler)
 	r.HandleFunc("/blog.atom", feedHandler)
 	r.HandleFunc("/blog.json", feedHandler)
+	r.HandleFunc("/blog/author/{username}.{format:rss|atom|json}", authorFeedHandler)
 	r.HandleFunc("/archive", archiveHandler)
 	r.HandleFunc("/tagged", taggedHandler)
+	r.HandleFunc("/tagged/{tag}.{format:rss|atom|json}", tagFeedHandler)
 	r.HandleFunc("/tagged/{tag}", taggedHandler)
+	r.HandleFunc("/series/{fragment}", seriesHandler)
 	r.HandleFunc("/blog/category/{tag}", func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		tag, ok := params["tag"]
@@ -75,6 +87,7 @@ func Register(r *mux.Router, loginError http.HandlerFunc) {
 	loginRouter := mux.NewRouter()
 	loginRouter.HandleFunc("/blog/edit", editHandler)
 	loginRouter.HandleFunc("/blog/delete", deleteHandler)
+	loginRouter.HandleFunc("/blog/history", historyHandler)
 	loginRouter.HandleFunc("/blog/drafts", drafts)
 	loginRouter.HandleFunc("/blog/private", privatePosts)
 	r.PathPrefix("/blog").Handler(
@@ -98,7 +111,8 @@ func RecentPosts(r *http.Request, tag, privacy string) []posts.Post {
 		if privacy != "" {
 			switch privacy {
 			case types.DRAFT:
-				if post.Privacy != types.DRAFT {
+				// Scheduled posts are drafts until they're published.
+				if post.Privacy != types.DRAFT && post.Privacy != types.SCHEDULED {
 					continue
 				}
 			case types.PRIVATE:
@@ -106,13 +120,9 @@ func RecentPosts(r *http.Request, tag, privacy string) []posts.Post {
 					continue
 				}
 			}
-		} else {
+		} else if !Visible(r, post.Privacy) {
 			// Exclude certain posts in generic index views.
-			if (post.Privacy == types.PRIVATE || post.Privacy == types.UNLISTED) && !auth.LoggedIn(r) {
-				continue
-			} else if post.Privacy == types.DRAFT {
-				continue
-			}
+			continue
 		}
 
 		// Limit by tag?
@@ -149,6 +159,18 @@ func RecentPosts(r *http.Request, tag, privacy string) []posts.Post {
 	return pool
 }
 
+// Visible returns whether posts with the given privacy setting show up in the
+// blog's listings (the index, archive, feeds and search) for this request.
+func Visible(r *http.Request, privacy string) bool {
+	switch privacy {
+	case types.DRAFT, types.SCHEDULED:
+		return false
+	case types.PRIVATE, types.UNLISTED:
+		return auth.LoggedIn(r)
+	}
+	return true
+}
+
 // ViewPost is the underlying implementation of the handler to view a blog
 // post, so that it can be called from non-http.HandlerFunc contexts.
 // Specifically, from the catch-all page handler to allow blog URL fragments
@@ -160,15 +182,39 @@ func ViewPost(w http.ResponseWriter, r *http.Request, fragment string) error {
 	}
 
 	// Handle post privacy.
-	if post.Privacy == types.PRIVATE || post.Privacy == types.DRAFT {
+	if post.Privacy == types.PRIVATE || post.Privacy == types.DRAFT || post.Privacy == types.SCHEDULED {
 		if !auth.LoggedIn(r) {
 			responses.NotFound(w, r, "That post is not public.")
 			return nil
 		}
 	}
 
+	// Let the browser keep its copy if nothing on the page has changed.
+	series := SeriesNavFor(r, post)
+	if idx, err := posts.GetIndex(); err == nil && !hasFlashes(r) {
+		version, updated := blogVersion(idx)
+		if series != nil {
+			version += series.Series.Updated.String()
+		}
+		thread, commented := commentsVersion(post)
+		if commented.After(updated) {
+			updated = commented
+		}
+
+		cacheControl(w, r)
+		etag := makeETag("post", post.ID, version, thread, viewerVersion(r))
+		if responses.NotModified(w, r, etag, updated) {
+			return nil
+		}
+	}
+
+	previous, next := Neighbors(r, post)
 	v := map[string]interface{}{
-		"Post": post,
+		"Post":     post,
+		"Previous": previous,
+		"Next":     next,
+		"Related":  RelatedPosts(r, post),
+		"Series":   series,
 	}
 	render.Template(w, r, "blog/entry", v)
 
@@ -186,6 +232,11 @@ func partialPost(r *http.Request, p *posts.Post, indexView bool, numComments int
 		author = users.DeletedUser()
 	}
 
+	// Posts that haven't been saved yet (i.e. previews) aren't counted yet.
+	if p.WordCount == 0 {
+		p.WordCount = posts.CountWords(p.Body)
+	}
+
 	// "Read More" snippet for index views.
 	var snipped bool
 	if indexView {
@@ -206,6 +257,10 @@ func partialPost(r *http.Request, p *posts.Post, indexView bool, numComments int
 		rendered = template.HTML(p.Body)
 	}
 
+	// Give the headings anchors for the table of contents.
+	html, toc := markdown.TableOfContents(string(rendered))
+	rendered = template.HTML(html)
+
 	meta := map[string]interface{}{
 		"Post":        p,
 		"Rendered":    rendered,
@@ -213,6 +268,9 @@ func partialPost(r *http.Request, p *posts.Post, indexView bool, numComments int
 		"IndexView":   indexView,
 		"Snipped":     snipped,
 		"NumComments": numComments,
+		"TOC":         toc,
+		"WordCount":   p.WordCount,
+		"ReadingTime": p.ReadingTime(),
 	}
 	output := bytes.Buffer{}
 	err = render.Template(&output, r, "blog/entry.partial", meta)
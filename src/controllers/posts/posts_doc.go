@@ -7,15 +7,20 @@ Routes
 	/blog             Blog index
 	/blog.rss         RSS feed
 	/blog.atom        Atom feed
+	/blog.json        JSON feed
+	/blog/author/<username>.rss    Feed of posts by an author (also .atom, .json)
 	/archive          Blog archives
 	/tagged           Index of all blog tags
 	/tagged/<tag>     View posts by tag
+	/tagged/<tag>.rss Feed of posts by tag (also .atom, .json)
+	/series/<fragment> Landing page of a series of posts
 	/<fragment>       View blog entry by its URL fragment
 
 	Admin Only
 	/blog/edit        Create or edit blog post
 	/blog/delete      Confirm deletion of blog post
-	/blog/drafts      View all draft entries
+	/blog/history     Revision history of a blog post; compare and restore
+	/blog/drafts      View all draft (and scheduled) entries
 	/blog/private     View all private entries
 
 Related Models
@@ -41,5 +46,40 @@ it has the IDs and can just select each one pretty quickly.
 In case anything goes wrong with the blog index, you can always delete the
 `posts/index.json` and it will be re-generated from scratch in a one-time scan
 of the entire posts DB (opening every document).
+
+Posts are looked up by URL fragment and by tag through JsonDB secondary indexes
+on the posts collection, which JsonDB keeps in sync under `_index/blog/posts/`
+whenever a post is saved or deleted. These can be deleted and rebuilt the same
+way.
+
+A post with the "scheduled" privacy setting is treated as a draft until its
+publish time. A background ticker checks the index every minute and makes due
+posts public, firing the same posts.OnPublish hooks as posting from the editor.
+
+Every save also keeps a full copy of the post at
+`blog/revisions/<id>/<timestamp>`, which the history page compares line by
+line. Restoring a revision saves it as the post again, so the restore is itself
+a new revision and can be undone the same way.
+
+A single entry links to the posts before and after it (by creation date) and
+lists the posts that share the most tags with it, all worked out from the index
+and limited to what the viewer could see in the blog listings. Templates can
+get the same with the PreviousPost, NextPost and RelatedPosts functions.
+
+Posts can be grouped into a series, an ordered list of post IDs with a title
+kept at `blog/series/<id>`. The series and part number are picked on the edit
+page, and a post in a series shows "part N of M" navigation. A series that loses
+its last post is deleted.
+
+Each post's word count is worked out when it's saved and kept in the blog index
+too, so listings like the archive can show a reading time without loading the
+posts. Headings in a rendered post get anchor IDs made from their text, and an
+entry with a few of them shows a table of contents; the entry partial gets the
+headings as TOC, along with WordCount and ReadingTime.
+
+The feeds and single entry pages send ETag and Last-Modified headers and answer
+conditional requests with 304 Not Modified. The validators come from the blog
+index, plus the comments and the viewer's session for an entry page. Rendered
+feeds are kept in memory until a post is saved or deleted.
 */
 package postctl
@@ -0,0 +1,155 @@
+package postctl
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/responses"
+)
+
+// SeriesNav is the "part N of M" navigation for a post in a series.
+type SeriesNav struct {
+	Series   *posts.Series
+	Part     int          // 1-based position of this post
+	Total    int          // number of parts
+	Parts    []posts.Post // in reading order, from the blog index
+	Previous *posts.Post
+	Next     *posts.Post
+}
+
+// SeriesNavFor works out the series navigation for a post, counting only the
+// parts the current user is allowed to see. It returns nil if the post isn't
+// in a series.
+func SeriesNavFor(r *http.Request, p *posts.Post) *SeriesNav {
+	series, err := posts.SeriesOf(p.ID)
+	if err != nil {
+		log.Error("SeriesNavFor: couldn't look up the series of post %d: %s", p.ID, err)
+		return nil
+	} else if series == nil {
+		return nil
+	}
+
+	parts := seriesParts(r, series, p.ID)
+	nav := &SeriesNav{
+		Series: series,
+		Total:  len(parts),
+		Parts:  parts,
+	}
+	for i, part := range parts {
+		if part.ID != p.ID {
+			continue
+		}
+		nav.Part = i + 1
+		if i > 0 {
+			nav.Previous = &parts[i-1]
+		}
+		if i < len(parts)-1 {
+			nav.Next = &parts[i+1]
+		}
+	}
+
+	return nav
+}
+
+// seriesParts returns the posts in a series that the current user can see,
+// plus the one with ID `current`, which they're already looking at.
+func seriesParts(r *http.Request, series *posts.Series, current int) []posts.Post {
+	idx, err := posts.GetIndex()
+	if err != nil {
+		log.Error("seriesParts: couldn't load the blog index: %s", err)
+		return nil
+	}
+
+	var parts []posts.Post
+	for _, id := range series.Posts {
+		if p, ok := idx.Posts[id]; ok && (id == current || Visible(r, p.Privacy)) {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// seriesHandler is the landing page for a series, listing its parts.
+func seriesHandler(w http.ResponseWriter, r *http.Request) {
+	series, err := posts.LoadSeriesFragment(mux.Vars(r)["fragment"])
+	if err != nil {
+		responses.NotFound(w, r, "That series was not found.")
+		return
+	}
+
+	parts := seriesParts(r, series, 0)
+	if len(parts) == 0 {
+		responses.NotFound(w, r, "That series was not found.")
+		return
+	}
+
+	idx, _ := posts.GetIndex()
+	render.Template(w, r, "blog/series", map[string]interface{}{
+		"Series":     series,
+		"Parts":      parts,
+		"Thumbnails": idx.Thumbnails,
+	})
+}
+
+// updateSeries sets the series of a post from the edit form. The "series"
+// field is a series ID, "new" to start one named by "series-title", or empty
+// for none; "series-part" is the part number to put it at.
+func updateSeries(r *http.Request, p *posts.Post) error {
+	var seriesID int
+	switch value := r.FormValue("series"); value {
+	case "":
+	case "new":
+		title := strings.TrimSpace(r.FormValue("series-title"))
+		if title == "" {
+			return fmt.Errorf("the new series needs a title")
+		}
+		series := &posts.Series{Title: title}
+		if err := series.Save(); err != nil {
+			return err
+		}
+		seriesID = series.ID
+	default:
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid series ID: %s", value)
+		}
+		seriesID = id
+	}
+
+	part, _ := strconv.Atoi(r.FormValue("series-part"))
+	return posts.SetSeries(p.ID, seriesID, part)
+}
+
+// seriesFormValues fills in the template variables for the series fields on
+// the edit page: from the form if it was submitted, or else from the post's
+// current series.
+func seriesFormValues(r *http.Request, p *posts.Post, v map[string]interface{}) {
+	all, err := posts.AllSeries()
+	if err != nil {
+		log.Error("Couldn't list the blog series: %s", err)
+	}
+	v["AllSeries"] = all
+
+	if r.Method == http.MethodPost {
+		v["SeriesID"] = r.FormValue("series")
+		v["SeriesTitle"] = r.FormValue("series-title")
+		v["SeriesPart"] = r.FormValue("series-part")
+		return
+	}
+
+	v["SeriesID"] = ""
+	v["SeriesPart"] = ""
+	if p.ID == 0 {
+		return
+	}
+	if series, err := posts.SeriesOf(p.ID); err == nil && series != nil {
+		v["SeriesID"] = strconv.Itoa(series.ID)
+		v["SeriesPart"] = strconv.Itoa(series.Part(p.ID))
+	}
+}
@@ -16,11 +16,13 @@ import (
 	"github.com/kirsle/blog/src/log"
 	"github.com/kirsle/blog/src/mail"
 	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/middleware"
 	"github.com/kirsle/blog/src/middleware/auth"
 	"github.com/kirsle/blog/src/models"
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/src/responses"
 	"github.com/kirsle/blog/src/sessions"
+	"github.com/kirsle/blog/src/spam"
 	"github.com/urfave/negroni"
 )
 
@@ -60,9 +62,18 @@ func questionsHandler(w http.ResponseWriter, r *http.Request) {
 	// Previewing, deleting, or posting?
 	if r.Method == http.MethodPost {
 		Q.ParseForm(r)
+		Q.IP = middleware.RemoteAddr(r)
+		Q.UserAgent = r.UserAgent()
 		log.Info("Q: %+v", Q)
 
-		if err := Q.Validate(); err != nil {
+		// Questions from visitors are checked against the ban list and the
+		// spam filters.
+		err := Q.Validate()
+		if user, _ := auth.CurrentUser(r); err == nil && !user.IsAuthenticated {
+			Q.Held, err = spam.Screen(spam.NewSubmission(r, spam.Question, Q.Name, Q.Email, Q.Question))
+		}
+
+		if err != nil {
 			log.Debug("Validation error on question form: %s", err.Error())
 			v["Error"] = err
 		} else {
@@ -79,25 +90,27 @@ func questionsHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			// Email the site admin.
+			// Email the site admin, unless the question is being held.
 			subject := fmt.Sprintf("Ask Me Anything (%s) from %s", cfg.Site.Title, Q.Name)
-			log.Info("Emailing site admin about this question")
-			go mail.SendEmail(mail.Email{
-				To:       cfg.Site.AdminEmail,
-				Admin:    true,
-				ReplyTo:  Q.Email,
-				Subject:  subject,
-				Template: ".email/generic.gohtml",
-				Data: map[string]interface{}{
-					"Subject": subject,
-					"Message": template.HTML(
-						markdown.RenderMarkdown(
-							Q.Question +
-								"\n\nAnswer this at " + strings.Trim(cfg.Site.URL, "/") + "/ask",
+			if !Q.Held {
+				log.Info("Emailing site admin about this question")
+				go mail.SendEmail(mail.Email{
+					To:       cfg.Site.AdminEmail,
+					Admin:    true,
+					ReplyTo:  Q.Email,
+					Subject:  subject,
+					Template: ".email/generic.gohtml",
+					Data: map[string]interface{}{
+						"Subject": subject,
+						"Message": template.HTML(
+							markdown.RenderMarkdown(
+								Q.Question +
+									"\n\nAnswer this at " + strings.Trim(cfg.Site.URL, "/") + "/ask",
+							),
 						),
-					),
-				},
-			})
+					},
+				})
+			}
 
 			// Log it to disk, too.
 			fh, err := os.OpenFile(filepath.Join(*render.UserRoot, ".questions.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
@@ -105,10 +118,13 @@ func questionsHandler(w http.ResponseWriter, r *http.Request) {
 				responses.Flash(w, r, "Error logging the message to disk: %s", err)
 			} else {
 				fh.WriteString(fmt.Sprintf(
-					"Date: %s\nName: %s\nEmail: %s\n\n%s\n\n--------------------\n\n",
+					"Date: %s\nName: %s\nEmail: %s\nIP: %s\nUser-Agent: %s\nHeld: %v\n\n%s\n\n--------------------\n\n",
 					time.Now().Format(time.UnixDate),
 					Q.Name,
 					Q.Email,
+					Q.IP,
+					Q.UserAgent,
+					Q.Held,
 					Q.Question,
 				))
 				fh.Close()
@@ -162,8 +178,20 @@ func answerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	submission := &spam.Submission{
+		Kind:  spam.Question,
+		Name:  Q.Name,
+		Email: Q.Email,
+		Body:  Q.Question,
+	}
+
+	// Answering a question or deleting it as spam trains the spam classifier.
 	switch submit {
 	case "answer":
+		if err := spam.Train(submission, false); err != nil {
+			log.Error("Couldn't train the spam classifier: %s", err)
+		}
+
 		// Prepare a Markdown-themed blog post and go to the Preview page for it.
 		blog := posts.New()
 		blog.Title = "Ask"
@@ -219,6 +247,14 @@ func answerHandler(w http.ResponseWriter, r *http.Request) {
 		Q.Save()
 		responses.FlashAndRedirect(w, r, "/ask", "Question deleted.")
 		return
+	case "spam":
+		if err := spam.Train(submission, true); err != nil {
+			log.Error("Couldn't train the spam classifier: %s", err)
+		}
+		Q.Status = models.Deleted
+		Q.Save()
+		responses.FlashAndRedirect(w, r, "/ask", "Question deleted as spam.")
+		return
 	default:
 		responses.FlashAndRedirect(w, r, "/ask", "Unknown submit action.")
 		return
@@ -0,0 +1,163 @@
+package searchctl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kirsle/blog/models/search"
+	"github.com/kirsle/blog/src/markdown"
+	"github.com/kirsle/blog/src/render"
+)
+
+// page is a Markdown page found in one of the document roots.
+type page struct {
+	URL      string
+	Absolute string
+	ModTime  time.Time
+}
+
+// IndexPages rescans the Markdown pages in the document roots and updates the
+// search index with any that were added, changed or removed.
+func IndexPages() error {
+	idx, err := search.Load()
+	if err != nil {
+		return err
+	}
+
+	pages, err := findPages()
+	if err != nil {
+		return err
+	}
+
+	var (
+		update []search.Document
+		seen   = map[string]bool{}
+	)
+	for _, p := range pages {
+		key := pageKey(p.URL)
+		seen[key] = true
+
+		if entry, ok := idx.Entries[key]; ok && entry.ModTime.Equal(p.ModTime) {
+			continue
+		}
+		if doc, err := p.document(); err == nil {
+			update = append(update, doc)
+		}
+	}
+
+	var remove []string
+	for key, entry := range idx.Entries {
+		if entry.Kind == search.KindPage && !seen[key] {
+			remove = append(remove, key)
+		}
+	}
+
+	if len(update) > 0 {
+		if err := search.Update(update...); err != nil {
+			return err
+		}
+	}
+	if len(remove) > 0 {
+		return search.Remove(remove...)
+	}
+	return nil
+}
+
+// findPages walks both document roots for Markdown pages. A page in the user
+// root hides the one with the same URL in the core root, the same way that
+// render.ResolvePath picks which one to serve.
+func findPages() ([]page, error) {
+	var (
+		result []page
+		seen   = map[string]bool{}
+	)
+
+	for _, root := range []string{*render.UserRoot, *render.DocumentRoot} {
+		if root == "" {
+			continue
+		}
+
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// Skip hidden files and folders, like the .private database.
+			if path != root && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || !strings.HasSuffix(path, ".md") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			url := render.URLFromPath(filepath.ToSlash(rel))
+			if seen[url] {
+				return nil
+			}
+
+			// Only index the file that's actually served at its URL.
+			resolved, err := render.ResolvePath(url)
+			if err != nil {
+				return nil
+			}
+			if abs, _ := filepath.Abs(path); resolved.Absolute != abs {
+				return nil
+			}
+
+			seen[url] = true
+			result = append(result, page{
+				URL:      url,
+				Absolute: resolved.Absolute,
+				ModTime:  info.ModTime(),
+			})
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// pageKey returns a page's key in the search index.
+func pageKey(url string) string {
+	return "page" + url
+}
+
+// document reads a page for the search index.
+func (p page) document() (search.Document, error) {
+	source, err := ioutil.ReadFile(p.Absolute)
+	if err != nil {
+		return search.Document{}, err
+	}
+
+	body := string(source)
+	title, err := markdown.TitleFromMarkdown(body)
+	title = strings.TrimSpace(title)
+	if err != nil || title == "" {
+		title = p.URL
+	}
+
+	return search.Document{
+		Entry: search.Entry{
+			Key:     pageKey(p.URL),
+			Kind:    search.KindPage,
+			Title:   title,
+			URL:     p.URL,
+			Date:    p.ModTime,
+			ModTime: p.ModTime,
+		},
+		Text: body,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package searchctl
+
+import (
+	"html/template"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
+	postctl "github.com/kirsle/blog/src/controllers/posts"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/render"
+)
+
+// ResultsPerPage is how many search results are shown on each page.
+var ResultsPerPage = 20
+
+// Register the search routes.
+func Register(r *mux.Router) {
+	r.HandleFunc("/search", searchHandler)
+}
+
+// Reindex brings the search index up to date when the app starts. The index
+// is built from scratch if it doesn't exist yet; otherwise only the pages are
+// rescanned, to pick up any edited on disk while the app was down.
+func Reindex() error {
+	if search.Exists() {
+		return IndexPages()
+	}
+
+	log.Info("Building the search index")
+	docs, err := posts.SearchDocuments()
+	if err != nil {
+		return err
+	}
+
+	pages, err := findPages()
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if doc, err := page.document(); err == nil {
+			docs = append(docs, doc)
+		}
+	}
+
+	return search.Rebuild(docs)
+}
+
+// searchHandler shows the results of a search.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.FormValue("q"))
+	v := map[string]interface{}{
+		"Query": query,
+	}
+
+	if query != "" {
+		idx, err := search.Load()
+		if err != nil {
+			log.Error("Error loading the search index: %s", err)
+			v["Error"] = err
+		} else {
+			// Drafts and private posts follow the same rules as the blog.
+			var results []search.Result
+			for _, result := range idx.Search(query) {
+				if result.Kind == search.KindPost && !postctl.Visible(r, result.Privacy) {
+					continue
+				}
+				results = append(results, result)
+			}
+			paginate(r, v, results, search.Terms(query))
+		}
+	}
+
+	render.Template(w, r, "search/results", v)
+}
+
+// Hit is a search result ready to show on the page.
+type Hit struct {
+	search.Result
+	Title   template.HTML
+	Snippet template.HTML
+}
+
+// paginate picks out the current page of results and builds their snippets.
+func paginate(r *http.Request, v map[string]interface{}, results []search.Result, terms []string) {
+	page, _ := strconv.Atoi(r.FormValue("page"))
+	if page <= 0 {
+		page = 1
+	}
+	pages := int(math.Ceil(float64(len(results)) / float64(ResultsPerPage)))
+
+	var hits []Hit
+	offset := (page - 1) * ResultsPerPage
+	for i := offset; i < offset+ResultsPerPage && i < len(results); i++ {
+		result := results[i]
+		hits = append(hits, Hit{
+			Result:  result,
+			Title:   highlight(result.Title, terms),
+			Snippet: snippet(sourceText(result), terms),
+		})
+	}
+
+	v["Hits"] = hits
+	v["Total"] = len(results)
+	v["Page"] = page
+	v["Pages"] = pages
+	if page > 1 {
+		v["PreviousPage"] = page - 1
+	}
+	if page < pages {
+		v["NextPage"] = page + 1
+	}
+}
+
+// sourceText loads the full text of a search result, for its snippet.
+func sourceText(result search.Result) string {
+	switch result.Kind {
+	case search.KindPost:
+		id, _ := strconv.Atoi(strings.TrimPrefix(result.Key, "post/"))
+		if p, err := posts.Load(id); err == nil {
+			return p.Body
+		}
+	case search.KindPage:
+		if fp, err := render.ResolvePath(result.URL); err == nil {
+			if source, err := ioutil.ReadFile(fp.Absolute); err == nil {
+				return string(source)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,29 @@
+/*
+Package searchctl implements the site search.
+
+Routes
+
+	Public
+	/search?q=        Search the blog posts and Markdown pages
+
+Related Models
+
+	search
+	posts
+
+Description
+
+The search index is an inverted index kept in JsonDB at `search/index`, from
+each word to the posts and pages it appears in, weighted by whether it was in
+the title, the tags or the body.
+
+Blog posts are updated in the index whenever they're saved or deleted. The
+Markdown pages in the user and core document roots are rescanned when the app
+starts and whenever a page is saved from the editor, so only pages changed by
+hand on disk need a restart to show up. If the index goes missing it's rebuilt
+from scratch on startup.
+
+Posts in the results follow the same privacy rules as the blog index: drafts
+are never shown, and private and unlisted posts only to logged-in users.
+*/
+package searchctl
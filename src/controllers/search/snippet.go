@@ -0,0 +1,121 @@
+package searchctl
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/kirsle/blog/models/search"
+)
+
+// How many words of context to show around the first match in a snippet.
+const (
+	snippetBefore = 12
+	snippetLength = 40
+)
+
+var (
+	reHTMLTag = regexp.MustCompile(`<[^>]*>`)
+	reLinkURL = regexp.MustCompile(`\]\([^)]*\)`)
+	reMarkup  = regexp.MustCompile("[#*_`>~|\\[\\]]+")
+)
+
+// plainText strips the HTML tags and the bulk of the Markdown syntax from a
+// post or page, to leave something readable for a snippet.
+func plainText(source string) string {
+	text := reHTMLTag.ReplaceAllString(source, " ")
+	text = reLinkURL.ReplaceAllString(text, "]")
+	text = reMarkup.ReplaceAllString(text, " ")
+	return html.UnescapeString(text)
+}
+
+// snippet returns a short excerpt of the text around the first search term
+// that appears in it, with the terms highlighted.
+func snippet(source string, terms []string) template.HTML {
+	words := strings.Fields(plainText(source))
+	if len(words) == 0 {
+		return ""
+	}
+
+	// Find the first word that matches.
+	want := termSet(terms)
+	var first int
+	for i, word := range words {
+		if matches(word, want) {
+			first = i
+			break
+		}
+	}
+
+	start := first - snippetBefore
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(words) {
+		end = len(words)
+	}
+
+	text := strings.Join(words[start:end], " ")
+	if start > 0 {
+		text = "... " + text
+	}
+	if end < len(words) {
+		text += " ..."
+	}
+	return highlight(text, terms)
+}
+
+// highlight escapes text for HTML and wraps each search term in it in a
+// <mark> tag.
+func highlight(text string, terms []string) template.HTML {
+	want := termSet(terms)
+
+	var (
+		output strings.Builder
+		word   strings.Builder
+	)
+	flush := func() {
+		if word.Len() == 0 {
+			return
+		}
+		if want[strings.ToLower(word.String())] {
+			output.WriteString("<mark>" + template.HTMLEscapeString(word.String()) + "</mark>")
+		} else {
+			output.WriteString(template.HTMLEscapeString(word.String()))
+		}
+		word.Reset()
+	}
+
+	for _, r := range text {
+		if search.IsWordRune(r) {
+			word.WriteRune(r)
+			continue
+		}
+		flush()
+		output.WriteString(template.HTMLEscapeString(string(r)))
+	}
+	flush()
+
+	return template.HTML(output.String())
+}
+
+// matches returns whether a word from the text contains any search term.
+func matches(word string, want map[string]bool) bool {
+	for _, w := range search.Words(word) {
+		if want[strings.ToLower(w)] {
+			return true
+		}
+	}
+	return false
+}
+
+// termSet makes a lookup table of search terms.
+func termSet(terms []string) map[string]bool {
+	set := map[string]bool{}
+	for _, term := range terms {
+		set[term] = true
+	}
+	return set
+}
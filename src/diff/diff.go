@@ -0,0 +1,132 @@
+// Package diff computes line-by-line differences between two texts.
+package diff
+
+import "strings"
+
+// Op is the kind of change a line represents.
+type Op string
+
+// Line operations.
+const (
+	Equal  Op = " "
+	Insert Op = "+"
+	Delete Op = "-"
+)
+
+// Line is one line of a diff.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// maxCells caps the size of the table used to find the longest common
+// subsequence, so a pathological pair of texts can't eat all the memory.
+const maxCells = 4000000
+
+// Lines returns the differences between texts `a` and `b`, line by line.
+func Lines(a, b string) []Line {
+	var (
+		x      = split(a)
+		y      = split(b)
+		result []Line
+	)
+
+	// Lines in common at the start and end don't need the expensive search.
+	var prefix, suffix int
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	for suffix < len(x)-prefix && suffix < len(y)-prefix &&
+		x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	for _, line := range x[:prefix] {
+		result = append(result, Line{Equal, line})
+	}
+	result = append(result, middle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, line := range x[len(x)-suffix:] {
+		result = append(result, Line{Equal, line})
+	}
+
+	return result
+}
+
+// Changed returns whether a diff has any insertions or deletions.
+func Changed(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// middle diffs the part of the texts between their common prefix and suffix,
+// using the longest common subsequence of their lines.
+func middle(x, y []string) []Line {
+	var result []Line
+
+	// Too big to compare (or nothing to); call it a wholesale replacement.
+	if len(x) == 0 || len(y) == 0 || len(x)*len(y) > maxCells {
+		for _, line := range x {
+			result = append(result, Line{Delete, line})
+		}
+		for _, line := range y {
+			result = append(result, Line{Insert, line})
+		}
+		return result
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int32, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			result = append(result, Line{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, Line{Delete, x[i]})
+			i++
+		default:
+			result = append(result, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		result = append(result, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		result = append(result, Line{Insert, y[j]})
+	}
+
+	return result
+}
+
+// split breaks a text into lines, ignoring the difference between Unix and
+// DOS line endings.
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
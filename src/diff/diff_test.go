@@ -0,0 +1,62 @@
+package diff_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kirsle/blog/src/diff"
+)
+
+func TestLines(t *testing.T) {
+	type testCase struct {
+		A, B   string
+		Expect string // each line prefixed by its op
+	}
+
+	tests := []testCase{
+		{
+			A:      "",
+			B:      "",
+			Expect: "",
+		},
+		{
+			A:      "one\ntwo\nthree",
+			B:      "one\ntwo\nthree\n",
+			Expect: " one| two| three",
+		},
+		{
+			A:      "one\ntwo\nthree",
+			B:      "one\n2\nthree",
+			Expect: " one|-two|+2| three",
+		},
+		{
+			A:      "a\nb\nc\nd",
+			B:      "b\nc\ne\nd\nf",
+			Expect: "-a| b| c|+e| d|+f",
+		},
+		{
+			A:      "",
+			B:      "new\npost",
+			Expect: "+new|+post",
+		},
+		{
+			A:      "windows\r\nline\r\n",
+			B:      "windows\nline",
+			Expect: " windows| line",
+		},
+	}
+
+	for _, test := range tests {
+		var got []string
+		for _, line := range diff.Lines(test.A, test.B) {
+			got = append(got, string(line.Op)+line.Text)
+		}
+		if result := strings.Join(got, "|"); result != test.Expect {
+			t.Errorf("Lines(%q, %q): expected %q, got %q", test.A, test.B, test.Expect, result)
+		}
+	}
+
+	if diff.Changed(diff.Lines("same", "same")) {
+		t.Errorf("identical texts reported as changed")
+	}
+}
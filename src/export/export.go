@@ -0,0 +1,451 @@
+// Package export renders the public parts of the blog into a folder of static
+// files, to host a read-only mirror without the Go server.
+//
+// Every page is rendered by requesting it from the app's own HTTP handler as an
+// anonymous visitor, so it goes through the same controllers and templates as
+// on the live site. HTML pages are saved as `<path>/index.html` and their links
+// are rewritten to relative paths, so the mirror works from any folder or
+// bucket; feeds and other files are saved under their own path.
+package export
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/models/users"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/render"
+	"github.com/kirsle/blog/src/types"
+)
+
+// ErrAgeGate is returned when the site has the age gate turned on, which a
+// static mirror couldn't enforce.
+var ErrAgeGate = errors.New("the site is behind an age gate, which a static mirror can't enforce")
+
+// Templates in these folders belong to a controller and aren't pages of their
+// own, even though the catch-all page handler would try to serve them.
+var templateDirs = []string{"admin/", "blog/", "comments/", "search/", "questions.gohtml"}
+
+// Feed formats exported alongside the blog, tag and author pages.
+var feedFormats = []string{"rss", "atom", "json"}
+
+var reLink = regexp.MustCompile(` (src|href|poster)=(['"])([^'"]*)(['"])`)
+
+// Exporter renders a site to a folder.
+type Exporter struct {
+	// Handler serves the site, i.e. the app's router with its middleware.
+	Handler http.Handler
+
+	// Dynamic returns whether a page's URL is served by a controller, such as
+	// the login or contact forms, which don't work on a static site. Optional.
+	Dynamic func(path string) bool
+
+	// Output is the folder to write the site to.
+	Output string
+
+	files map[string]string // page key -> file, relative to Output
+	pages map[string][]byte // page key -> HTML not yet written out
+	queue []string
+}
+
+// Site exports the site served by `handler` into the `output` folder and
+// returns the number of pages written.
+func Site(handler http.Handler, output string, dynamic func(string) bool) (int, error) {
+	e := &Exporter{
+		Handler: handler,
+		Dynamic: dynamic,
+		Output:  output,
+	}
+	return e.Run()
+}
+
+// Run exports the site and returns the number of pages written.
+func (e *Exporter) Run() (int, error) {
+	s, err := settings.Load()
+	if err != nil {
+		s = settings.Defaults()
+	}
+	if s.Site.NSFW {
+		return 0, ErrAgeGate
+	}
+
+	e.files = map[string]string{}
+	e.pages = map[string][]byte{}
+	e.queue = nil
+
+	if err := os.MkdirAll(e.Output, 0755); err != nil {
+		return 0, err
+	}
+	if err := e.copyAssets(); err != nil {
+		return 0, fmt.Errorf("copying static files: %s", err)
+	}
+
+	seeds, err := e.seeds()
+	if err != nil {
+		return 0, err
+	}
+	for _, seed := range seeds {
+		e.enqueue(seed)
+	}
+
+	// Rendering a page may turn up more pages of it to fetch.
+	var count int
+	for i := 0; i < len(e.queue); i++ {
+		ok, err := e.fetch(e.queue[i])
+		if err != nil {
+			return count, err
+		}
+		if ok {
+			count++
+		}
+	}
+
+	// Only now is it known which links lead to exported pages.
+	for key, body := range e.pages {
+		body = e.rewrite(key, body)
+		if err := e.write(e.files[key], bytes.NewReader(body)); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// seeds lists the URLs to start exporting from.
+func (e *Exporter) seeds() ([]string, error) {
+	urls := []string{"/", "/blog", "/archive", "/tagged", "/css/gfm.css"}
+	for _, format := range feedFormats {
+		urls = append(urls, "/blog."+format)
+	}
+
+	// Public posts, and their tags and authors.
+	idx, err := posts.GetIndex()
+	if err != nil {
+		return nil, fmt.Errorf("loading the blog index: %s", err)
+	}
+	var (
+		tags    = map[string]bool{}
+		authors = map[int]bool{}
+	)
+	for _, p := range idx.Posts {
+		if p.Privacy != string(types.PUBLIC) && p.Privacy != "" {
+			continue
+		}
+		urls = append(urls, "/"+p.Fragment)
+		for _, tag := range p.Tags {
+			tags[tag] = true
+		}
+		authors[p.AuthorID] = true
+	}
+
+	for tag := range tags {
+		urls = append(urls, "/tagged/"+tag)
+		for _, format := range feedFormats {
+			urls = append(urls, "/tagged/"+tag+"."+format)
+		}
+	}
+	for id := range authors {
+		author, err := users.LoadReadonly(id)
+		if err != nil {
+			continue
+		}
+		for _, format := range feedFormats {
+			urls = append(urls, "/blog/author/"+author.Username+"."+format)
+		}
+	}
+
+	// Series landing pages; a series with no public posts is skipped when it
+	// doesn't render.
+	series, err := posts.AllSeries()
+	if err != nil {
+		return nil, fmt.Errorf("loading the series: %s", err)
+	}
+	for _, s := range series {
+		urls = append(urls, "/series/"+s.Fragment)
+	}
+
+	pages, err := e.findPages()
+	if err != nil {
+		return nil, err
+	}
+	urls = append(urls, pages...)
+
+	sort.Strings(urls)
+	return urls, nil
+}
+
+// findPages walks both document roots for the .md and .gohtml pages. A page in
+// the user root hides the one with the same URL in the core root, the same way
+// that render.ResolvePath picks which one to serve.
+func (e *Exporter) findPages() ([]string, error) {
+	var (
+		result []string
+		seen   = map[string]bool{}
+	)
+
+	for _, root := range []string{*render.UserRoot, *render.DocumentRoot} {
+		if root == "" {
+			continue
+		}
+
+		err := filepath.Walk(root, func(fp string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.skipFile(root, fp, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || !isPage(fp) || strings.Contains(info.Name(), ".partial") {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, fp)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			for _, dir := range templateDirs {
+				if strings.HasPrefix(rel, dir) {
+					return nil
+				}
+			}
+
+			// An index page is served at its folder's URL.
+			url := render.URLFromPath(rel)
+			if path.Base(url) == "index" {
+				url = path.Dir(url)
+			}
+			if seen[url] || (e.Dynamic != nil && e.Dynamic(url)) {
+				return nil
+			}
+			seen[url] = true
+			result = append(result, url)
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// copyAssets copies the static files (anything but pages and templates) from
+// both document roots, with the user root's copy of a file winning.
+func (e *Exporter) copyAssets() error {
+	for _, root := range []string{*render.UserRoot, *render.DocumentRoot} {
+		if root == "" {
+			continue
+		}
+
+		err := filepath.Walk(root, func(fp string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.skipFile(root, fp, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() || isPage(fp) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(root, fp)
+			if err != nil {
+				return err
+			}
+			key := "/" + filepath.ToSlash(rel)
+			if _, ok := e.files[key]; ok {
+				return nil
+			}
+
+			fh, err := os.Open(fp)
+			if err != nil {
+				return err
+			}
+			defer fh.Close()
+			if err := e.write(key, fh); err != nil {
+				return err
+			}
+			e.files[key] = key
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipFile returns whether a file or folder in a document root is never part of
+// the export: hidden files (like the .private database) and the export itself,
+// if it's being written inside a document root.
+func (e *Exporter) skipFile(root, fp string, info os.FileInfo) bool {
+	if fp == root {
+		return false
+	}
+	if strings.HasPrefix(info.Name(), ".") {
+		return true
+	}
+	abs, _ := filepath.Abs(fp)
+	output, _ := filepath.Abs(e.Output)
+	return abs == output
+}
+
+// isPage returns whether a file is a page rather than a static file.
+func isPage(fp string) bool {
+	switch filepath.Ext(fp) {
+	case ".gohtml", ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// enqueue adds a URL to the list to fetch, unless it's already on it.
+func (e *Exporter) enqueue(key string) {
+	if _, ok := e.files[key]; ok {
+		return
+	}
+	e.files[key] = ""
+	e.queue = append(e.queue, key)
+}
+
+// fetch renders a page with a synthetic request to the site's handler, and
+// returns whether it was exported. Pages that don't render with 200 OK for an
+// anonymous visitor are skipped.
+func (e *Exporter) fetch(key string) (bool, error) {
+	// Keys hold the decoded path, which may have spaces in a tag name.
+	parts := strings.SplitN(key, "?", 2)
+	u := &url.URL{Path: parts[0]}
+	if len(parts) > 1 {
+		u.RawQuery = parts[1]
+	}
+
+	req := httptest.NewRequest("GET", u.RequestURI(), nil)
+	rec := httptest.NewRecorder()
+	e.Handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		log.Info("Export: skipping %s (HTTP %d)", key, rec.Code)
+		delete(e.files, key)
+		return false, nil
+	}
+
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		e.files[key] = u.Path
+		return true, e.write(u.Path, rec.Body)
+	}
+
+	file := path.Join(u.Path, "index.html")
+	if page, _ := strconv.Atoi(u.Query().Get("page")); page > 1 {
+		file = path.Join(u.Path, "page", strconv.Itoa(page), "index.html")
+	}
+	e.files[key] = file
+	e.pages[key] = rec.Body.Bytes()
+
+	// Follow the links to more pages of this listing.
+	for _, m := range reLink.FindAllSubmatch(rec.Body.Bytes(), -1) {
+		if link, ok := pageKey(key, string(m[3])); ok && strings.Contains(link, "?page=") {
+			if _, queued := e.files[strings.SplitN(link, "?", 2)[0]]; queued {
+				e.enqueue(link)
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// rewrite points the links in a page at the exported files, relative to the
+// page itself. Links to things that weren't exported are left alone.
+func (e *Exporter) rewrite(key string, body []byte) []byte {
+	dir := path.Dir(e.files[key])
+	return reLink.ReplaceAllFunc(body, func(match []byte) []byte {
+		m := reLink.FindSubmatch(match)
+		link, ok := pageKey(key, string(m[3]))
+		if !ok {
+			return match
+		}
+
+		target := e.files[link]
+		if target == "" {
+			return match
+		}
+
+		rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+		if err != nil {
+			return match
+		}
+		segments := strings.Split(filepath.ToSlash(rel), "/")
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		href := strings.Join(segments, "/")
+		if i := strings.Index(html.UnescapeString(string(m[3])), "#"); i >= 0 {
+			href += html.UnescapeString(string(m[3]))[i:]
+		}
+
+		return []byte(fmt.Sprintf(" %s=%s%s%s", m[1], m[2], html.EscapeString(href), m[4]))
+	})
+}
+
+// pageKey resolves a link found on the page `from` and returns the key of the
+// page it leads to: its path, plus its page number if it's past the first.
+// Links to other sites, or with any other query parameters, aren't pages.
+func pageKey(from, link string) (string, bool) {
+	base, err := url.Parse(from)
+	if err != nil {
+		return "", false
+	}
+	ref, err := url.Parse(html.UnescapeString(link))
+	if err != nil || ref.Scheme != "" || ref.Host != "" || (ref.Path == "" && ref.RawQuery == "") {
+		return "", false
+	}
+	u := base.ResolveReference(ref)
+
+	key := u.Path
+	query := u.Query()
+	if page, err := strconv.Atoi(query.Get("page")); err == nil {
+		query.Del("page")
+		if page > 1 {
+			key += "?page=" + strconv.Itoa(page)
+		}
+	}
+	if len(query) > 0 {
+		return "", false
+	}
+	return key, true
+}
+
+// write saves a file into the output folder.
+func (e *Exporter) write(name string, r io.Reader) error {
+	fp := filepath.Join(e.Output, filepath.FromSlash(strings.TrimPrefix(name, "/")))
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, data, 0644)
+}
@@ -0,0 +1,128 @@
+package export_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
+	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/models/users"
+	"github.com/kirsle/blog/src/export"
+	"github.com/kirsle/blog/src/render"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	userRoot := filepath.Join(dir, "user")
+	coreRoot := filepath.Join(dir, "core")
+	files := map[string]string{
+		"core/about.md":            "# About",
+		"core/contact.gohtml":      "contact form",
+		"core/blog/index.gohtml":   "a controller's template",
+		"core/css/site.css":        "core css",
+		"core/css/theme.css":       "core theme",
+		"user/css/theme.css":       "user theme",
+		"user/.private/secret.txt": "secret",
+	}
+	for name, content := range files {
+		fp := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fp), 0755)
+		if err := ioutil.WriteFile(fp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render.UserRoot = &userRoot
+	render.DocumentRoot = &coreRoot
+
+	db := jsondb.New(filepath.Join(userRoot, ".private"))
+	settings.DB = db
+	posts.DB = db
+	search.DB = db
+	users.DB = db
+	for _, p := range []*posts.Post{
+		{Title: "Public", Fragment: "public", Privacy: "public", Tags: []string{"a b"}},
+		{Title: "Draft", Fragment: "draft", Privacy: "draft"},
+	} {
+		p.ContentType = "markdown"
+		p.Body = "Hello"
+		if err := p.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A stand-in for the app's router.
+	var requested []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.RequestURI())
+		switch {
+		case r.URL.Path == "/blog.rss":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprint(w, `<rss><link href="/public"/></rss>`)
+		case r.URL.Path == "/blog" && r.FormValue("page") == "":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/public#top">x</a> <a href="?page=2">older</a> <a href="/contact">c</a>`)
+		case r.URL.Path == "/blog":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/blog?page=1">newer</a> <link href="/css/theme.css">`)
+		case r.URL.Path == "/tagged/a b":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/tagged/a%20b">self</a> <a href="/">home</a>`)
+		case r.URL.Path == "/" || r.URL.Path == "/public" || r.URL.Path == "/about":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/tagged/a%20b">tag</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	dynamic := func(path string) bool {
+		return path == "/contact"
+	}
+
+	output := filepath.Join(dir, "out")
+	if _, err := export.Site(handler, output, dynamic); err != nil {
+		t.Fatalf("Site: %s", err)
+	}
+
+	expect := map[string]string{
+		"index.html":             `<a href="tagged/a%20b/index.html">tag</a>`,
+		"about/index.html":       `<a href="../tagged/a%20b/index.html">tag</a>`,
+		"public/index.html":      `<a href="../tagged/a%20b/index.html">tag</a>`,
+		"blog/index.html":        `<a href="../public/index.html#top">x</a> <a href="page/2/index.html">older</a> <a href="/contact">c</a>`,
+		"blog/page/2/index.html": `<a href="../../index.html">newer</a> <link href="../../../css/theme.css">`,
+		"tagged/a b/index.html":  `<a href="index.html">self</a> <a href="../../index.html">home</a>`,
+		"blog.rss":               `<rss><link href="/public"/></rss>`,
+		"css/theme.css":          "user theme",
+		"css/site.css":           "core css",
+	}
+	for name, content := range expect {
+		data, err := ioutil.ReadFile(filepath.Join(output, name))
+		if err != nil {
+			t.Errorf("%s wasn't exported: %s", name, err)
+		} else if string(data) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, string(data))
+		}
+	}
+
+	for _, name := range []string{"draft/index.html", "contact/index.html", "blog/index/index.html", ".private/secret.txt", "about.md"} {
+		if _, err := os.Stat(filepath.Join(output, name)); err == nil {
+			t.Errorf("%s shouldn't have been exported", name)
+		}
+	}
+	for _, uri := range requested {
+		if strings.Contains(uri, "draft") || uri == "/contact" {
+			t.Errorf("shouldn't have requested %s", uri)
+		}
+	}
+}
@@ -7,12 +7,15 @@ import (
 
 // Contact form for the site admin.
 type Contact struct {
-	Name    string
-	Email   string
-	Subject string
-	Message string
-	Trap1   string // 'contact'
-	Trap2   string // 'website'
+	Name      string
+	Email     string
+	Subject   string
+	Message   string
+	IP        string
+	UserAgent string
+	Held      bool   // sent by somebody on the ban list
+	Trap1     string // 'contact'
+	Trap2     string // 'website'
 }
 
 // ParseForm parses the form.
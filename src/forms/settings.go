@@ -3,6 +3,10 @@ package forms
 import (
 	"errors"
 	"net/mail"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/src/spam"
 )
 
 // Settings are the user-facing admin settings.
@@ -14,11 +18,22 @@ type Settings struct {
 	NSFW         bool
 	PostsPerPage int
 	PostsPerFeed int
+	Moderation   string
+	MaxDepth     int
+	MaxLinks     int
+	Blocklist    []string
+	IPRate       int
+	EmailRate    int
+	Classifier   bool
+	Proxies      []string
 	RedisEnabled bool
 	RedisHost    string
 	RedisPort    int
 	RedisDB      int
 	RedisPrefix  string
+	WatchFiles   bool
+	MemoryCache  bool
+	MaxKeys      int
 	MailEnabled  bool
 	MailSender   string
 	MailHost     string
@@ -32,6 +47,28 @@ func (f Settings) Validate() error {
 	if len(f.Title) == 0 {
 		return errors.New("website title is required")
 	}
+	if f.PostsPerFeed < 1 {
+		return errors.New("posts per feed must be at least 1")
+	}
+	switch f.Moderation {
+	case settings.ModerateAll, settings.ModerateNew, settings.AutoApprove:
+	default:
+		return errors.New("invalid setting for comment moderation")
+	}
+	if f.MaxDepth < 1 {
+		return errors.New("comment reply depth must be at least 1")
+	}
+	if f.MaxLinks < 0 || f.IPRate < 0 || f.EmailRate < 0 {
+		return errors.New("spam filter limits can't be negative")
+	}
+	if _, err := spam.NewBlocklist(f.Blocklist); err != nil {
+		return err
+	}
+	for _, proxy := range f.Proxies {
+		if err := comments.ValidateIP(proxy); err != nil {
+			return err
+		}
+	}
 	if f.AdminEmail != "" {
 		_, err := mail.ParseAddress(f.AdminEmail)
 		if err != nil {
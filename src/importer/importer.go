@@ -0,0 +1,123 @@
+// Package importer converts blog archives from other software into posts and
+// comments.
+//
+// Each source format is read into a list of Entries, which Save writes to the
+// blog the same way as posting from the editor. Images they link to can be
+// copied into the user root's static/photos folder with Photos, which rewrites
+// the links to point at the local copies.
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/src/log"
+)
+
+// Entry is a blog post read from an archive, with its comments.
+type Entry struct {
+	Post     *posts.Post
+	Comments []*comments.Comment
+	Source   string // where it came from, for log messages
+}
+
+// Save writes an entry's post to the blog, then its comments to the post's
+// comment thread. The post keeps its URL fragment, unless another post already
+// has it.
+func Save(e *Entry) error {
+	if e.Post.AuthorID == 0 {
+		e.Post.AuthorID = 1
+	}
+	if err := e.Post.Validate(); err != nil {
+		return err
+	}
+	if err := e.Post.Save(); err != nil {
+		return err
+	}
+
+	if len(e.Comments) == 0 {
+		return nil
+	}
+
+	thread := comments.New(fmt.Sprintf("post-%d", e.Post.ID))
+	for _, c := range e.Comments {
+		c.OriginURL = "/" + e.Post.Fragment
+		c.Subject = e.Post.Title
+		if c.Updated.IsZero() {
+			c.Updated = c.Created
+		}
+		c.LoadAvatar()
+		if err := thread.Post(c); err != nil {
+			return fmt.Errorf("comment by %s: %s", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// mergeTags combines categories and tags into one list of blog tags, without
+// duplicates.
+func mergeTags(lists ...[]string) []string {
+	var (
+		result = []string{}
+		seen   = map[string]bool{}
+	)
+	for _, list := range lists {
+		for _, tag := range list {
+			tag = strings.TrimSpace(tag)
+			if tag == "" || seen[strings.ToLower(tag)] {
+				continue
+			}
+			seen[strings.ToLower(tag)] = true
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// reBlockTag matches the HTML tags that start a block of their own, which
+// autoParagraph shouldn't wrap in a paragraph.
+var reBlockTag = regexp.MustCompile(`(?i)^<(p|div|h[1-6]|ul|ol|li|pre|blockquote|table|figure|hr|img|iframe|script|style|!--)[\s>/]`)
+
+// autoParagraph adds the paragraph and line break tags that WordPress leaves
+// out of stored posts and adds when showing them: blank lines separate
+// paragraphs and single line breaks are kept.
+func autoParagraph(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+
+	var result []string
+	for _, block := range regexp.MustCompile(`\n\s*\n`).Split(text, -1) {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		if reBlockTag.MatchString(block) {
+			result = append(result, block)
+			continue
+		}
+		result = append(result, "<p>"+strings.Replace(block, "\n", "<br>\n", -1)+"</p>")
+	}
+	return strings.Join(result, "\n\n")
+}
+
+// Import saves entries to the blog, first copying the images they link to if
+// `photos` is given. It logs the entries that fail and returns how many were
+// imported.
+func Import(entries []*Entry, photos *Photos) int {
+	var count int
+	for _, e := range entries {
+		if photos != nil {
+			e.Post.Body = photos.Rewrite(e.Post.Body)
+		}
+
+		if err := Save(e); err != nil {
+			log.Error("Couldn't import %s: %s", e.Source, err)
+			continue
+		}
+		log.Info("Imported post %d: %s", e.Post.ID, e.Post.Title)
+		count++
+	}
+	return count
+}
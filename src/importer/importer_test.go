@@ -0,0 +1,231 @@
+package importer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/posts"
+	"github.com/kirsle/blog/models/search"
+	"github.com/kirsle/blog/src/importer"
+)
+
+const sampleWXR = `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<item>
+		<title>Hello World</title>
+		<content:encoded><![CDATA[First paragraph
+with a line break.
+
+<img src="http://example.com/wp-content/uploads/2015/01/cat.jpg">]]></content:encoded>
+		<wp:post_date><![CDATA[2015-01-02 03:04:05]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[2015-01-02 11:04:05]]></wp:post_date_gmt>
+		<wp:post_name><![CDATA[hello-world]]></wp:post_name>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+		<wp:comment_status><![CDATA[open]]></wp:comment_status>
+		<category domain="category" nicename="uncategorized"><![CDATA[Uncategorized]]></category>
+		<category domain="category" nicename="news"><![CDATA[News]]></category>
+		<category domain="post_tag" nicename="go"><![CDATA[go]]></category>
+		<wp:comment>
+			<wp:comment_id>7</wp:comment_id>
+			<wp:comment_author><![CDATA[Alice]]></wp:comment_author>
+			<wp:comment_date_gmt><![CDATA[2015-01-03 00:00:00]]></wp:comment_date_gmt>
+			<wp:comment_content><![CDATA[Nice post!]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[1]]></wp:comment_approved>
+			<wp:comment_type><![CDATA[comment]]></wp:comment_type>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_id>8</wp:comment_id>
+			<wp:comment_parent>7</wp:comment_parent>
+			<wp:comment_author><![CDATA[Bob]]></wp:comment_author>
+			<wp:comment_content><![CDATA[Hold this one.]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[0]]></wp:comment_approved>
+		</wp:comment>
+		<wp:comment>
+			<wp:comment_author><![CDATA[Spammer]]></wp:comment_author>
+			<wp:comment_content><![CDATA[Buy now]]></wp:comment_content>
+			<wp:comment_approved><![CDATA[spam]]></wp:comment_approved>
+		</wp:comment>
+	</item>
+	<item>
+		<title>Unfinished</title>
+		<wp:post_date><![CDATA[2015-02-01 00:00:00]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[0000-00-00 00:00:00]]></wp:post_date_gmt>
+		<wp:post_name><![CDATA[]]></wp:post_name>
+		<wp:status><![CDATA[draft]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+	<item>
+		<title>About</title>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[page]]></wp:post_type>
+	</item>
+</channel>
+</rss>`
+
+func TestImport(t *testing.T) {
+	root, err := ioutil.TempDir("", "importer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	db := jsondb.New(filepath.Join(root, ".private"))
+	posts.DB = db
+	comments.DB = db
+	search.DB = db
+
+	// The old site's uploads.
+	uploads := filepath.Join(root, "uploads")
+	os.MkdirAll(filepath.Join(uploads, "2015", "01"), 0755)
+	ioutil.WriteFile(filepath.Join(uploads, "2015", "01", "cat.jpg"), []byte("meow"), 0644)
+
+	entries, err := importer.ReadWXR(strings.NewReader(sampleWXR))
+	if err != nil {
+		t.Fatalf("ReadWXR: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	hello, draft := entries[0].Post, entries[1].Post
+	if hello.Fragment != "hello-world" || hello.Privacy != "public" || !hello.EnableComments {
+		t.Errorf("unexpected post: %+v", hello)
+	}
+	if !reflect.DeepEqual(hello.Tags, []string{"News", "go"}) {
+		t.Errorf("unexpected tags: %v", hello.Tags)
+	}
+	if !hello.Created.Equal(time.Date(2015, 1, 2, 11, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected date: %s", hello.Created)
+	}
+	if !strings.Contains(hello.Body, "<p>First paragraph<br>\nwith a line break.</p>") {
+		t.Errorf("paragraphs weren't added: %s", hello.Body)
+	}
+	if draft.Privacy != "draft" || draft.Created.IsZero() {
+		t.Errorf("unexpected draft: %+v", draft)
+	}
+	if cs := entries[0].Comments; len(cs) != 2 || cs[0].Name != "Alice" || cs[0].IsPending() || !cs[1].IsPending() {
+		t.Errorf("expected an approved and a pending comment, got %+v", cs)
+	}
+
+	photos := importer.NewPhotos(root, uploads)
+	if n := importer.Import(entries, photos); n != 2 {
+		t.Errorf("expected 2 posts imported, got %d", n)
+	}
+
+	saved, err := posts.LoadFragment("hello-world")
+	if err != nil {
+		t.Fatalf("LoadFragment: %s", err)
+	}
+	if strings.Contains(saved.Body, "example.com") || !strings.Contains(saved.Body, `src="/static/photos/`) {
+		t.Errorf("image link wasn't rewritten: %s", saved.Body)
+	}
+	if files, _ := ioutil.ReadDir(filepath.Join(root, "static", "photos")); len(files) != 1 {
+		t.Errorf("expected the image to be copied, got %d files", len(files))
+	}
+
+	thread, err := comments.Load("post-1")
+	if err != nil || len(thread.Approved()) != 1 || thread.Comments[0].Body != "Nice post!" {
+		t.Errorf("comments weren't imported: %+v (%v)", thread, err)
+	} else if len(thread.Comments) != 2 || thread.Comments[1].ParentID != thread.Comments[0].ID {
+		t.Errorf("the reply lost its parent: %+v", thread.Comments)
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	var tests = []struct {
+		name   string
+		text   string
+		expect map[string]string
+		lists  map[string][]string
+		body   string
+	}{
+		{
+			name: "jekyll",
+			text: "---\nlayout: post\ntitle: \"Hello: World\"\ndate: 2017-05-06 07:08:09 -0400\n" +
+				"categories: go web\ntags:\n  - one\n  - \"two\"\npublished: false\n---\nThe body.\n",
+			expect: map[string]string{"title": "Hello: World", "published": "false"},
+			lists: map[string][]string{
+				"categories": {"go", "web"},
+				"tags":       {"one", "two"},
+			},
+			body: "The body.\n",
+		},
+		{
+			name: "hugo",
+			text: "+++\ntitle = 'Hugo Post'\ndraft = true\ntags = [\"a\", \"b\"]\n" +
+				"[params]\ntitle = \"ignored\"\n+++\n\nBody",
+			expect: map[string]string{"title": "Hugo Post", "draft": "true"},
+			lists:  map[string][]string{"tags": {"a", "b"}},
+			body:   "\nBody",
+		},
+		{
+			name:   "none",
+			text:   "Just text\n---\n",
+			expect: map[string]string{"title": ""},
+			body:   "Just text\n---\n",
+		},
+	}
+
+	for _, test := range tests {
+		meta, body := importer.ParseFrontMatter(test.text)
+		for key, value := range test.expect {
+			if meta.String(key) != value {
+				t.Errorf("%s: expected %s=%q, got %q", test.name, key, value, meta.String(key))
+			}
+		}
+		for key, value := range test.lists {
+			if !reflect.DeepEqual(meta.List(key), value) {
+				t.Errorf("%s: expected %s=%v, got %v", test.name, key, value, meta.List(key))
+			}
+		}
+		if body != test.body {
+			t.Errorf("%s: expected body %q, got %q", test.name, test.body, body)
+		}
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	root, err := ioutil.TempDir("", "importer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(filepath.Join(root, "_posts"), 0755)
+	os.MkdirAll(filepath.Join(root, "_drafts"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "_posts", "2016-03-04-my-post.md"),
+		[]byte("---\ntitle: My Post\ncategory: Blog\ntags: [go]\n---\n![A cat](/assets/cat.png)\n"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "_drafts", "wip.markdown"),
+		[]byte("---\ntitle: WIP\n---\nSoon.\n"), 0644)
+
+	entries, err := importer.ReadMarkdownDir(root)
+	if err != nil {
+		t.Fatalf("ReadMarkdownDir: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	draft, post := entries[0].Post, entries[1].Post
+	if post.Fragment != "my-post" || post.Privacy != "public" || post.ContentType != "markdown" ||
+		!post.Created.Equal(time.Date(2016, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected post: %+v", post)
+	}
+	if !reflect.DeepEqual(post.Tags, []string{"Blog", "go"}) {
+		t.Errorf("unexpected tags: %v", post.Tags)
+	}
+	if draft.Title != "WIP" || draft.Privacy != "draft" || draft.Fragment != "wip" {
+		t.Errorf("unexpected draft: %+v", draft)
+	}
+}
@@ -0,0 +1,277 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kirsle/blog/models/posts"
+)
+
+// FrontMatter holds the metadata at the top of a Jekyll or Hugo post.
+type FrontMatter map[string]interface{}
+
+// reJekyllName matches Jekyll's "YYYY-MM-DD-slug.md" post file names.
+var reJekyllName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// Date formats seen in front matter.
+var frontMatterTimes = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ReadMarkdownDir reads every Markdown and HTML post under a folder, like a
+// Jekyll site's _posts and _drafts or a Hugo site's content/posts. Files in a
+// _drafts folder are imported as drafts.
+func ReadMarkdownDir(root string) ([]*Entry, error) {
+	var entries []*Entry
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext != ".md" && ext != ".markdown" && ext != ".html" {
+			return nil
+		}
+		// Hugo's section index pages aren't posts.
+		if strings.HasPrefix(info.Name(), "_index.") {
+			return nil
+		}
+
+		entry, err := ReadMarkdown(path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// ReadMarkdown reads a Jekyll or Hugo post from a file.
+func ReadMarkdown(path string) (*Entry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, body := ParseFrontMatter(string(data))
+
+	// Jekyll puts the date and slug in the file name.
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	slug := name
+	var created time.Time
+	if m := reJekyllName.FindStringSubmatch(name); m != nil {
+		created, _ = time.Parse("2006-01-02", m[1])
+		slug = m[2]
+	}
+	if t, ok := meta.Time("date"); ok {
+		created = t
+	}
+	if created.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			created = info.ModTime()
+		}
+	}
+	if s := meta.String("slug"); s != "" {
+		slug = s
+	}
+
+	updated := created
+	for _, key := range []string{"lastmod", "last_modified_at", "updated"} {
+		if t, ok := meta.Time(key); ok && t.After(created) {
+			updated = t
+		}
+	}
+
+	title := meta.String("title")
+	if title == "" {
+		title = slug
+	}
+
+	p := &posts.Post{
+		Title:          title,
+		Fragment:       slug,
+		ContentType:    "markdown",
+		Body:           strings.TrimSpace(body),
+		Privacy:        "public",
+		EnableComments: true,
+		Tags:           mergeTags(meta.List("categories"), meta.List("category"), meta.List("tags")),
+		Created:        created.UTC(),
+		Updated:        updated.UTC(),
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".html" {
+		p.ContentType = "html"
+	}
+
+	// Jekyll marks drafts by folder or "published: false"; Hugo by "draft".
+	inDrafts := strings.Contains(filepath.ToSlash(path), "/_drafts/")
+	if published, ok := meta.Bool("published"); inDrafts || (ok && !published) {
+		p.Privacy = "draft"
+	}
+	if draft, _ := meta.Bool("draft"); draft {
+		p.Privacy = "draft"
+	}
+	if comments, ok := meta.Bool("comments"); ok {
+		p.EnableComments = comments
+	}
+
+	return &Entry{
+		Post:   p,
+		Source: path,
+	}, nil
+}
+
+// ParseFrontMatter splits the front matter off the top of a post. It reads
+// YAML front matter between "---" lines (Jekyll and Hugo) or TOML between
+// "+++" lines (Hugo), as far as posts need: plain keys with strings, numbers,
+// booleans, dates and lists.
+func ParseFrontMatter(text string) (FrontMatter, string) {
+	meta := FrontMatter{}
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	var delim, sep string
+	switch {
+	case strings.HasPrefix(text, "---\n"):
+		delim, sep = "---", ":"
+	case strings.HasPrefix(text, "+++\n"):
+		delim, sep = "+++", "="
+	default:
+		return meta, text
+	}
+
+	lines := strings.Split(text, "\n")
+	var (
+		end     = -1
+		lastKey string
+		inTable bool // past a TOML [table] header
+	)
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == delim {
+			end = i
+			break
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// A YAML list item under the previous key.
+		if strings.HasPrefix(trimmed, "- ") && lastKey != "" {
+			list, _ := meta[lastKey].([]string)
+			meta[lastKey] = append(list, unquote(strings.TrimSpace(trimmed[2:])))
+			continue
+		}
+
+		// Nested values (indented lines and TOML tables) aren't needed.
+		if line != strings.TrimLeft(line, " \t") {
+			continue
+		}
+		if delim == "+++" && strings.HasPrefix(trimmed, "[") {
+			inTable = true
+		}
+		if inTable {
+			continue
+		}
+
+		parts := strings.SplitN(line, sep, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+		lastKey = key
+
+		if value == "" {
+			meta[key] = []string{}
+		} else if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			var list []string
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					list = append(list, item)
+				}
+			}
+			meta[key] = list
+		} else {
+			meta[key] = unquote(value)
+		}
+	}
+
+	if end < 0 {
+		// Never closed; treat it all as the body.
+		return FrontMatter{}, text
+	}
+	return meta, strings.Join(lines[end+1:], "\n")
+}
+
+// unquote strips the quotes around a front matter string, if any.
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if s, err := strconv.Unquote(value); err == nil {
+				return s
+			}
+		}
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// String returns a front matter value as a string.
+func (fm FrontMatter) String(key string) string {
+	switch v := fm[key].(type) {
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, " ")
+	}
+	return ""
+}
+
+// List returns a front matter value as a list. A single string is split on
+// spaces, like Jekyll does for categories and tags.
+func (fm FrontMatter) List(key string) []string {
+	switch v := fm[key].(type) {
+	case []string:
+		return v
+	case string:
+		return strings.Fields(v)
+	}
+	return nil
+}
+
+// Bool returns a front matter value as a boolean, and whether it was set.
+func (fm FrontMatter) Bool(key string) (bool, bool) {
+	b, err := strconv.ParseBool(fm.String(key))
+	return b, err == nil
+}
+
+// Time returns a front matter value as a time, and whether it was set.
+func (fm FrontMatter) Time(key string) (time.Time, bool) {
+	value := fm.String(key)
+	if value == "" {
+		return time.Time{}, false
+	}
+	for _, format := range frontMatterTimes {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,130 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/kirsle/blog/src/log"
+)
+
+// reImageURL finds image links in HTML attributes and Markdown.
+var reImageURL = regexp.MustCompile(`(?i)(?:(?:src|href)=["']|\]\()([^"'()\s]+\.(?:jpe?g|png|gif))(?:\?[^"'()\s]*)?`)
+
+// Photos copies the images that imported posts link to into the user root's
+// static/photos folder, named by checksum like the editor's uploads, and
+// rewrites the links to the local copies.
+type Photos struct {
+	// Output folder, usually <user root>/static/photos.
+	Output string
+
+	// Folders to look for the images in, like a copy of the old site or of
+	// WordPress' wp-content/uploads.
+	Sources []string
+
+	copied  map[string]string // original URL -> new URL, or "" if missing
+	Missing []string          // image URLs that couldn't be found
+}
+
+// NewPhotos prepares to copy images into the user root.
+func NewPhotos(userRoot string, sources ...string) *Photos {
+	return &Photos{
+		Output:  filepath.Join(userRoot, "static", "photos"),
+		Sources: sources,
+		copied:  map[string]string{},
+	}
+}
+
+// Rewrite copies the images a post links to and returns its body with the
+// links pointing at the copies. Links to images that can't be found are left
+// alone and added to Missing.
+func (ph *Photos) Rewrite(body string) string {
+	if len(ph.Sources) == 0 {
+		return body
+	}
+
+	return reImageURL.ReplaceAllStringFunc(body, func(match string) string {
+		groups := reImageURL.FindStringSubmatch(match)
+		link := groups[1]
+
+		local, err := ph.copy(link)
+		if err != nil {
+			return match
+		}
+
+		// Keep the attribute or Markdown prefix; drop the old query string.
+		prefix := match[:strings.Index(match, link)]
+		return prefix + local
+	})
+}
+
+// copy finds the image behind a link and copies it to the output folder,
+// returning its new URL.
+func (ph *Photos) copy(link string) (string, error) {
+	if local, ok := ph.copied[link]; ok {
+		if local == "" {
+			return "", os.ErrNotExist
+		}
+		return local, nil
+	}
+
+	source, err := ph.find(link)
+	if err != nil {
+		ph.Missing = append(ph.Missing, link)
+		ph.copied[link] = ""
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + strings.ToLower(filepath.Ext(source))
+	if err := os.MkdirAll(ph.Output, 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(ph.Output, name), data, 0644); err != nil {
+		return "", err
+	}
+
+	local := "/static/photos/" + name
+	log.Debug("Copied image %s to %s", link, local)
+	ph.copied[link] = local
+	return local, nil
+}
+
+// find looks for the file behind an image link in the source folders. The
+// link's path is tried whole and then with leading folders taken off, so
+// that "https://example.com/wp-content/uploads/2015/01/cat.jpg" is found at
+// "<source>/2015/01/cat.jpg" or just "<source>/cat.jpg".
+func (ph *Photos) find(link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	p, err := url.PathUnescape(u.Path)
+	if err != nil {
+		p = u.Path
+	}
+
+	parts := strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/")
+	for i := range parts {
+		rel := filepath.FromSlash(strings.Join(parts[i:], "/"))
+		for _, source := range ph.Sources {
+			candidate := filepath.Join(source, rel)
+			if stat, err := os.Stat(candidate); err == nil && !stat.IsDir() {
+				return candidate, nil
+			}
+		}
+	}
+
+	return "", os.ErrNotExist
+}
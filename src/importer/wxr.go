@@ -0,0 +1,181 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/posts"
+)
+
+// wxrTime is the date format in WordPress exports.
+const wxrTime = "2006-01-02 15:04:05"
+
+// WordPress eXtended RSS, as written by WordPress' Tools -> Export. Fields in
+// the wp: namespace are matched by name alone, since its URL changes with the
+// version of the format.
+type wxrFile struct {
+	Items []wxrItem `xml:"channel>item"`
+}
+
+type wxrItem struct {
+	Title         string        `xml:"title"`
+	Content       string        `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PostDate      string        `xml:"post_date"`
+	PostDateGMT   string        `xml:"post_date_gmt"`
+	PostName      string        `xml:"post_name"`
+	Status        string        `xml:"status"`
+	PostType      string        `xml:"post_type"`
+	Password      string        `xml:"post_password"`
+	CommentStatus string        `xml:"comment_status"`
+	IsSticky      int           `xml:"is_sticky"`
+	Categories    []wxrCategory `xml:"category"`
+	Comments      []wxrComment  `xml:"comment"`
+}
+
+type wxrCategory struct {
+	Domain   string `xml:"domain,attr"`
+	Nicename string `xml:"nicename,attr"`
+	Name     string `xml:",chardata"`
+}
+
+type wxrComment struct {
+	ID          string `xml:"comment_id"`
+	Parent      string `xml:"comment_parent"`
+	Author      string `xml:"comment_author"`
+	AuthorEmail string `xml:"comment_author_email"`
+	Date        string `xml:"comment_date"`
+	DateGMT     string `xml:"comment_date_gmt"`
+	Content     string `xml:"comment_content"`
+	Approved    string `xml:"comment_approved"`
+	Type        string `xml:"comment_type"`
+}
+
+// ReadWXR reads the blog posts from a WordPress export file. Pages,
+// attachments and posts in the trash are skipped, and so are pingbacks and
+// comments marked as spam or trash. Comments still waiting for approval are
+// imported into the moderation queue.
+func ReadWXR(r io.Reader) ([]*Entry, error) {
+	var file wxrFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("not a WordPress export: %s", err)
+	}
+
+	var entries []*Entry
+	for _, item := range file.Items {
+		if item.PostType != "post" || item.Status == "trash" {
+			continue
+		}
+		entries = append(entries, item.entry())
+	}
+	return entries, nil
+}
+
+// entry converts a WordPress post.
+func (item wxrItem) entry() *Entry {
+	var categories, tags []string
+	for _, c := range item.Categories {
+		switch c.Domain {
+		case "category":
+			if c.Nicename != "uncategorized" {
+				categories = append(categories, c.Name)
+			}
+		case "post_tag":
+			tags = append(tags, c.Name)
+		}
+	}
+
+	fragment, err := url.PathUnescape(item.PostName)
+	if err != nil {
+		fragment = item.PostName
+	}
+
+	created := wxrDate(item.PostDateGMT, item.PostDate)
+	p := &posts.Post{
+		Title:          item.Title,
+		Fragment:       fragment,
+		ContentType:    "html",
+		Body:           autoParagraph(item.Content),
+		Privacy:        "public",
+		Sticky:         item.IsSticky == 1,
+		EnableComments: item.CommentStatus == "open",
+		Tags:           mergeTags(categories, tags),
+		Created:        created,
+		Updated:        created,
+	}
+
+	switch item.Status {
+	case "private":
+		p.Privacy = "private"
+	case "future":
+		p.Privacy = "scheduled"
+		p.PublishAt = created
+	case "draft", "pending", "auto-draft":
+		p.Privacy = "draft"
+	default:
+		// Password protected posts have no equivalent; keep them hidden.
+		if item.Password != "" {
+			p.Privacy = "private"
+		}
+	}
+
+	entry := &Entry{
+		Post:   p,
+		Source: item.PostName,
+	}
+	for _, c := range item.Comments {
+		if c.Type != "" && c.Type != "comment" {
+			continue
+		}
+
+		// Comments still waiting for approval in WordPress go into the
+		// moderation queue; spam and trash are left behind.
+		var status string
+		switch c.Approved {
+		case "1":
+			status = comments.StatusApproved
+		case "0":
+			status = comments.StatusPending
+		default:
+			continue
+		}
+
+		// Replies keep pointing at their parent by its WordPress ID.
+		var id, parent string
+		if c.ID != "" {
+			id = "wp-" + c.ID
+		}
+		if c.Parent != "" && c.Parent != "0" {
+			parent = "wp-" + c.Parent
+		}
+
+		created := wxrDate(c.DateGMT, c.Date)
+		entry.Comments = append(entry.Comments, &comments.Comment{
+			ID:       id,
+			ParentID: parent,
+			Name:     c.Author,
+			Email:    c.AuthorEmail,
+			Body:     strings.TrimSpace(c.Content),
+			Status:   status,
+			Created:  created,
+			Updated:  created,
+		})
+	}
+	return entry
+}
+
+// wxrDate parses a WordPress timestamp, preferring the UTC one. Drafts have
+// a GMT date of all zeros, so the local one is used instead.
+func wxrDate(gmt, local string) time.Time {
+	if t, err := time.Parse(wxrTime, gmt); err == nil {
+		return t
+	}
+	if t, err := time.ParseInLocation(wxrTime, local, time.Local); err == nil {
+		return t.UTC()
+	}
+	return time.Now().UTC()
+}
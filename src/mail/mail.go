@@ -13,6 +13,7 @@ import (
 	"github.com/kirsle/blog/src/render"
 	"github.com/kirsle/blog/models/comments"
 	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/models/users"
 	"github.com/microcosm-cc/bluemonday"
 	gomail "gopkg.in/gomail.v2"
 )
@@ -102,40 +103,73 @@ func SendEmail(email Email) {
 }
 
 // NotifyComment sends notification emails about comments.
+//
+// A comment that's waiting for moderation is only sent to the site admins;
+// the thread's subscribers hear about it once it's approved, with
+// NotifyApproved.
 func NotifyComment(c *comments.Comment) {
+	email, ok := commentEmail(c)
+	if !ok {
+		return
+	}
+
+	// Email the site admins.
+	config, _ := settings.Load()
+	if config.Site.AdminEmail != "" {
+		email.To = config.Site.AdminEmail
+		email.Admin = true
+		if c.IsPending() {
+			email.Subject = "Comment Awaiting Moderation: " + c.Subject
+		}
+		log.Info("Mail site admin '%s' about comment notification on '%s'", email.To, c.ThreadID)
+		SendEmail(email)
+	}
+
+	if !c.IsPending() {
+		notifySubscribers(email, c)
+		notifyParent(email, c)
+	}
+}
+
+// NotifyApproved emails a thread's subscribers about a comment that was held
+// for moderation and has now been approved.
+func NotifyApproved(c *comments.Comment) {
+	if email, ok := commentEmail(c); ok {
+		notifySubscribers(email, c)
+		notifyParent(email, c)
+	}
+}
+
+// commentEmail prepares the email payload about a comment.
+func commentEmail(c *comments.Comment) (Email, bool) {
 	s, _ := settings.Load()
 	if s.Site.URL == "" {
 		log.Error("Can't send comment notification because the site URL is not configured")
-		return
+		return Email{}, false
 	}
 
-	// Prepare the email payload.
-	email := Email{
+	return Email{
 		Template: ".email/comment.gohtml",
 		Subject:  "Comment Added: " + c.Subject,
 		Data: map[string]interface{}{
-			"Name":    c.Name,
-			"Subject": c.Subject,
-			"Body":    template.HTML(markdown.RenderMarkdown(c.Body)),
-			"URL":     strings.Trim(s.Site.URL, "/") + c.OriginURL,
+			"Name":     c.Name,
+			"Subject":  c.Subject,
+			"Body":     template.HTML(markdown.RenderMarkdown(c.Body)),
+			"URL":      strings.Trim(s.Site.URL, "/") + c.OriginURL,
+			"Pending":  c.IsPending(),
+			"Moderate": strings.Trim(s.Site.URL, "/") + "/admin/comments",
 			"QuickDelete": fmt.Sprintf("%s/comments/quick-delete?t=%s&d=%s",
 				strings.Trim(s.Site.URL, "/"),
 				url.QueryEscape(c.ThreadID),
 				url.QueryEscape(c.DeleteToken),
 			),
 		},
-	}
-
-	// Email the site admins.
-	config, _ := settings.Load()
-	if config.Site.AdminEmail != "" {
-		email.To = config.Site.AdminEmail
-		email.Admin = true
-		log.Info("Mail site admin '%s' about comment notification on '%s'", email.To, c.ThreadID)
-		SendEmail(email)
-	}
+	}, true
+}
 
-	// Email the subscribers.
+// notifySubscribers emails everyone subscribed to a comment's thread.
+func notifySubscribers(email Email, c *comments.Comment) {
+	s, _ := settings.Load()
 	email.Admin = false
 	m := comments.LoadMailingList()
 	for _, to := range m.List(c.ThreadID) {
@@ -153,6 +187,53 @@ func NotifyComment(c *comments.Comment) {
 	}
 }
 
+// notifyParent emails the author of the comment that this one replies to,
+// unless they're already getting it as a subscriber of the thread.
+func notifyParent(email Email, c *comments.Comment) {
+	if c.ParentID == "" {
+		return
+	}
+
+	t, err := comments.Load(c.ThreadID)
+	if err != nil {
+		return
+	}
+	parent, err := t.Find(c.ParentID)
+	if err != nil || parent.Deleted {
+		return
+	}
+
+	to := parent.Email
+	if parent.UserID > 0 {
+		if user, err := users.Load(parent.UserID); err == nil {
+			to = user.Email
+		}
+	}
+	if to == "" || strings.EqualFold(to, c.Email) {
+		return
+	}
+	for _, subscriber := range comments.LoadMailingList().List(c.ThreadID) {
+		if strings.EqualFold(subscriber, to) {
+			return
+		}
+	}
+
+	// The data map is shared with the other notifications about this
+	// comment, so mark the reply on a copy of it.
+	data := map[string]interface{}{}
+	for key, value := range email.Data {
+		data[key] = value
+	}
+	data["Reply"] = true
+
+	email.To = to
+	email.Admin = false
+	email.Subject = "Reply to your comment: " + c.Subject
+	email.Data = data
+	log.Info("Mail '%s' about a reply to their comment on '%s'", email.To, c.ThreadID)
+	SendEmail(email)
+}
+
 // ParseAddress parses an email address.
 func ParseAddress(addr string) (*mail.Address, error) {
 	return mail.ParseAddress(addr)
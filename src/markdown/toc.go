@@ -0,0 +1,102 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Heading is an entry in a table of contents.
+type Heading struct {
+	Level int    // 1 to 6
+	ID    string // anchor ID of the heading
+	Text  string
+}
+
+var (
+	reHeading   = regexp.MustCompile(`(?is)<h([1-6])(\s[^>]*)?>(.*?)</h[1-6]>`)
+	reHeadingID = regexp.MustCompile(`(?i)\sid=["']([^"']+)["']`)
+	reTag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+// TableOfContents finds the headings in rendered HTML and gives each of them
+// an anchor ID, returning the new HTML and the headings in order.
+//
+// The IDs come from the text of the headings, so they stay the same as long as
+// the headings do; a repeated heading gets a numbered suffix. Headings that
+// already have an ID keep it.
+func TableOfContents(input string) (string, []Heading) {
+	var (
+		headings []Heading
+		used     = map[string]bool{}
+	)
+
+	// IDs given by hand win over the generated ones.
+	for _, m := range reHeading.FindAllStringSubmatch(input, -1) {
+		if id := reHeadingID.FindStringSubmatch(m[2]); id != nil {
+			used[id[1]] = true
+		}
+	}
+
+	output := reHeading.ReplaceAllStringFunc(input, func(tag string) string {
+		m := reHeading.FindStringSubmatch(tag)
+		level := int(m[1][0] - '0')
+		attrs, inner := m[2], m[3]
+
+		heading := Heading{
+			Level: level,
+			Text:  strings.TrimSpace(html.UnescapeString(reTag.ReplaceAllString(inner, ""))),
+		}
+
+		if id := reHeadingID.FindStringSubmatch(attrs); id != nil {
+			heading.ID = id[1]
+		} else {
+			heading.ID = uniqueID(anchorID(heading.Text), used)
+			attrs = fmt.Sprintf(` id="%s"%s`, heading.ID, attrs)
+			tag = fmt.Sprintf("<h%d%s>%s</h%d>", level, attrs, inner, level)
+		}
+
+		headings = append(headings, heading)
+		return tag
+	})
+
+	return output, headings
+}
+
+// anchorID turns the text of a heading into an anchor ID: lowercase letters
+// and numbers separated by hyphens.
+func anchorID(text string) string {
+	var (
+		id     strings.Builder
+		hyphen bool
+	)
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && id.Len() > 0 {
+				id.WriteRune('-')
+			}
+			id.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+
+	if id.Len() == 0 {
+		return "section"
+	}
+	return id.String()
+}
+
+// uniqueID returns the ID, or the ID with the first free numbered suffix if
+// it's already used, and marks the result used.
+func uniqueID(id string, used map[string]bool) string {
+	result := id
+	for i := 1; used[result]; i++ {
+		result = fmt.Sprintf("%s-%d", id, i)
+	}
+	used[result] = true
+	return result
+}
@@ -0,0 +1,48 @@
+package markdown_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kirsle/blog/src/markdown"
+)
+
+func TestTableOfContents(t *testing.T) {
+	input := `<h2>Getting Started</h2>
+<p>Intro</p>
+<h3 class="x">Install &amp; <em>Run</em>!</h3>
+<h2 id="setup">Custom</h2>
+<h2>Getting   started</h2>
+<h2>Setup</h2>
+<h4>???</h4>`
+
+	html, toc := markdown.TableOfContents(input)
+
+	expect := []markdown.Heading{
+		{2, "getting-started", "Getting Started"},
+		{3, "install-run", "Install & Run!"},
+		{2, "setup", "Custom"},
+		{2, "getting-started-1", "Getting   started"},
+		{2, "setup-1", "Setup"},
+		{4, "section", "???"},
+	}
+	if !reflect.DeepEqual(toc, expect) {
+		t.Errorf("unexpected headings:\n%+v", toc)
+	}
+
+	expectHTML := `<h2 id="getting-started">Getting Started</h2>
+<p>Intro</p>
+<h3 id="install-run" class="x">Install &amp; <em>Run</em>!</h3>
+<h2 id="setup">Custom</h2>
+<h2 id="getting-started-1">Getting   started</h2>
+<h2 id="setup-1">Setup</h2>
+<h4 id="section">???</h4>`
+	if html != expectHTML {
+		t.Errorf("unexpected HTML:\n%s", html)
+	}
+
+	// Rendering the same post again gives the same anchors.
+	if again, _ := markdown.TableOfContents(input); again != html {
+		t.Errorf("anchors aren't stable:\n%s", again)
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/settings"
+)
+
+// RemoteAddr returns the IP address of the visitor who made the request.
+//
+// When the request came from one of the trusted proxies in the settings, the
+// X-Forwarded-For header is followed back from the proxy to the first address
+// that isn't a trusted proxy. The header is ignored otherwise, since anybody
+// can send it.
+func RemoteAddr(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	s, err := settings.Load()
+	if err != nil || !comments.InNetworks(ip, s.Security.TrustedProxies) {
+		return ip
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !comments.InNetworks(hop, s.Security.TrustedProxies) {
+			break
+		}
+	}
+	return ip
+}
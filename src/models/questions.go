@@ -10,13 +10,16 @@ import (
 
 // Question is a question asked of the blog owner.
 type Question struct {
-	ID       int       `json:"id"`
-	Name     string    `json:"name"`
-	Email    string    `json:"email"`
-	Question string    `json:"question"`
-	Status   Status    `json:"status"`
-	Created  time.Time `json:"created"`
-	Updated  time.Time `json:"updated"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Question  string    `json:"question"`
+	Status    Status    `json:"status"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	Held      bool      `json:"held"` // asked by somebody on the ban list
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
 }
 
 // NewQuestion creates a blank Question with sensible defaults.
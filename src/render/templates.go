@@ -125,7 +125,7 @@ func Template(w io.Writer, r *http.Request, path string, data interface{}) error
 	// The comment entry partial.
 	commentEntry, err := ResolvePath("comments/entry.partial")
 	if err != nil {
-		log.Error("RenderTemplate(%s): comments/entry.partial not found")
+		log.Error("RenderTemplate(%s): comments/entry.partial not found", path)
 		return err
 	}
 
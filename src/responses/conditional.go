@@ -0,0 +1,56 @@
+package responses
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NotModified sets the ETag and Last-Modified validators on a response and,
+// if the request's If-None-Match or If-Modified-Since header shows the client
+// already has this version, answers with 304 Not Modified. It returns true if
+// it did, in which case the handler shouldn't write anything else.
+//
+// The ETag should be quoted, like `"abc123"`. If-None-Match takes priority
+// over If-Modified-Since, per RFC 7232.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if etag == "" || !etagMatches(match, etag) {
+			return false
+		}
+	} else if since := r.Header.Get("If-Modified-Since"); since != "" && !modified.IsZero() {
+		t, err := http.ParseTime(since)
+		if err != nil || modified.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches checks an If-None-Match header against an ETag, using the weak
+// comparison the header calls for.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
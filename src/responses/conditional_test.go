@@ -0,0 +1,61 @@
+package responses_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/src/responses"
+)
+
+func TestNotModified(t *testing.T) {
+	var (
+		etag     = `"abc123"`
+		modified = time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+		earlier  = modified.Add(-time.Hour).Format(http.TimeFormat)
+		later    = modified.Add(time.Hour).Format(http.TimeFormat)
+	)
+
+	var tests = []struct {
+		method  string
+		headers map[string]string
+		expect  bool
+	}{
+		{"GET", nil, false},
+		{"GET", map[string]string{"If-None-Match": etag}, true},
+		{"GET", map[string]string{"If-None-Match": `"other", W/"abc123"`}, true},
+		{"GET", map[string]string{"If-None-Match": `"other"`}, false},
+		{"GET", map[string]string{"If-None-Match": "*"}, true},
+		{"GET", map[string]string{"If-Modified-Since": later}, true},
+		{"GET", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"GET", map[string]string{"If-Modified-Since": earlier}, false},
+		{"GET", map[string]string{"If-Modified-Since": "garbage"}, false},
+
+		// If-None-Match wins over If-Modified-Since.
+		{"GET", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": later}, false},
+		{"POST", map[string]string{"If-None-Match": etag}, false},
+	}
+
+	for i, test := range tests {
+		r := httptest.NewRequest(test.method, "/blog.rss", nil)
+		for k, v := range test.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+
+		result := responses.NotModified(w, r, etag, modified)
+		if result != test.expect {
+			t.Errorf("test %d: expected %v, got %v", i, test.expect, result)
+		}
+		if result && w.Code != http.StatusNotModified {
+			t.Errorf("test %d: expected a 304 status, got %d", i, w.Code)
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Errorf("test %d: missing ETag header", i)
+		}
+		if w.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+			t.Errorf("test %d: wrong Last-Modified header: %s", i, w.Header().Get("Last-Modified"))
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package responses
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/feeds"
+)
+
+// Feed writes a feed in the format picked by the request's file extension:
+// Atom for `.atom`, JSON Feed for `.json` and RSS for anything else.
+func Feed(w http.ResponseWriter, r *http.Request, feed *feeds.Feed) {
+	contentType, body, err := EncodeFeed(r, feed)
+	if err != nil {
+		Error(w, r, "Error encoding the feed: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// EncodeFeed serializes a feed the way Feed would send it, returning its
+// content type and body.
+func EncodeFeed(r *http.Request, feed *feeds.Feed) (string, []byte, error) {
+	var (
+		contentType string
+		body        string
+		err         error
+	)
+	if strings.HasSuffix(r.URL.Path, ".atom") {
+		contentType = "application/atom+xml; encoding=utf-8"
+		body, err = feed.ToAtom()
+	} else if strings.HasSuffix(r.URL.Path, ".json") {
+		contentType = "application/json; encoding=utf-8"
+		body, err = feed.ToJSON()
+	} else {
+		contentType = "application/rss+xml; encoding=utf-8"
+		body, err = feed.ToRss()
+	}
+	return contentType, []byte(body), err
+}
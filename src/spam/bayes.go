@@ -0,0 +1,206 @@
+package spam
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kirsle/blog/jsondb"
+)
+
+// ClassifierDBName is the path to the classifier's training data.
+const ClassifierDBName = "spam/classifier"
+
+// DefaultThreshold is how sure the classifier has to be that something is
+// spam before the Bayes filter turns it away.
+const DefaultThreshold = 0.95
+
+// MinTraining is how many examples of both spam and ham the classifier has to
+// be trained on before it makes any decisions.
+const MinTraining = 5
+
+// Classifier is a naive Bayes classifier that learns to tell spam from
+// legitimate messages ("ham") from the examples an admin marks.
+type Classifier struct {
+	Spam     map[string]int `json:"spam"` // word counts in the spam examples
+	Ham      map[string]int `json:"ham"`  // and in the ham examples
+	SpamDocs int            `json:"spamDocs"`
+	HamDocs  int            `json:"hamDocs"`
+
+	totals *totals // worked out once for the cached classifier
+}
+
+// totals are the word counts that SpamProbability needs for every message.
+type totals struct {
+	spamWords  int
+	hamWords   int
+	vocabulary int // distinct words seen in either class
+}
+
+// cached is the classifier that the Bayes filter checks submissions with,
+// loaded once and dropped whenever the classifier is trained.
+var cached struct {
+	sync.Mutex
+	db         *jsondb.DB // the DB it was loaded from
+	classifier *Classifier
+}
+
+// LoadClassifier loads the classifier, or initializes it if it doesn't exist.
+func LoadClassifier() *Classifier {
+	c := &Classifier{
+		Spam: map[string]int{},
+		Ham:  map[string]int{},
+	}
+	if DB != nil {
+		DB.Get(ClassifierDBName, &c)
+	}
+	return c
+}
+
+// cachedClassifier returns the classifier, loading it if it isn't cached.
+// It's shared, so it mustn't be modified.
+func cachedClassifier() *Classifier {
+	cached.Lock()
+	defer cached.Unlock()
+	if cached.classifier == nil || cached.db != DB {
+		c := LoadClassifier()
+		t := c.count()
+		c.totals = &t
+		cached.db = DB
+		cached.classifier = c
+	}
+	return cached.classifier
+}
+
+// Train the classifier with an example of spam or ham.
+func (c *Classifier) Train(text string, spam bool) error {
+	defer func() {
+		cached.Lock()
+		cached.classifier = nil
+		cached.Unlock()
+	}()
+
+	return DB.Update(ClassifierDBName, c, func() error {
+		if c.Spam == nil {
+			c.Spam = map[string]int{}
+		}
+		if c.Ham == nil {
+			c.Ham = map[string]int{}
+		}
+
+		counts := c.Ham
+		if spam {
+			counts = c.Spam
+			c.SpamDocs++
+		} else {
+			c.HamDocs++
+		}
+		for _, word := range tokenize(text) {
+			counts[word]++
+		}
+		return nil
+	})
+}
+
+// Train the classifier with a submission an admin marked as spam or ham.
+func Train(s *Submission, isSpam bool) error {
+	return LoadClassifier().Train(s.Text(), isSpam)
+}
+
+// Ready returns whether the classifier has seen enough examples to be used.
+func (c *Classifier) Ready() bool {
+	return c.SpamDocs >= MinTraining && c.HamDocs >= MinTraining
+}
+
+// SpamProbability returns how likely the text is to be spam, from 0 to 1.
+func (c *Classifier) SpamProbability(text string) float64 {
+	if c.SpamDocs == 0 || c.HamDocs == 0 {
+		return 0.5
+	}
+
+	t := c.totals
+	if t == nil {
+		counted := c.count()
+		t = &counted
+	}
+	spamWords, hamWords := t.spamWords, t.hamWords
+	v := float64(t.vocabulary)
+
+	total := float64(c.SpamDocs + c.HamDocs)
+	logSpam := math.Log(float64(c.SpamDocs) / total)
+	logHam := math.Log(float64(c.HamDocs) / total)
+	for _, word := range tokenize(text) {
+		_, inSpam := c.Spam[word]
+		_, inHam := c.Ham[word]
+		if !inSpam && !inHam {
+			continue
+		}
+		logSpam += math.Log((float64(c.Spam[word]) + 1) / (float64(spamWords) + v))
+		logHam += math.Log((float64(c.Ham[word]) + 1) / (float64(hamWords) + v))
+	}
+
+	return 1 / (1 + math.Exp(logHam-logSpam))
+}
+
+// count the words seen in each class and the vocabulary, for Laplace
+// smoothing of words that only one class has seen.
+func (c *Classifier) count() totals {
+	var t totals
+	for word, n := range c.Spam {
+		t.spamWords += n
+		t.vocabulary++
+		if _, ok := c.Ham[word]; ok {
+			t.vocabulary-- // counted again below
+		}
+	}
+	for _, n := range c.Ham {
+		t.hamWords += n
+		t.vocabulary++
+	}
+	return t
+}
+
+// tokenize splits text into its distinct lowercase words.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '$'
+	})
+
+	var (
+		result []string
+		seen   = map[string]bool{}
+	)
+	for _, word := range words {
+		word = strings.Trim(word, "'")
+		if len(word) < 2 || len(word) > 40 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		result = append(result, word)
+	}
+	return result
+}
+
+// Bayes rejects submissions that the trained classifier thinks are spam.
+type Bayes struct {
+	Threshold float64
+}
+
+// Name of the filter.
+func (b Bayes) Name() string {
+	return "classifier"
+}
+
+// Check the submission with the classifier. Nothing is rejected until it's
+// been trained well enough.
+func (b Bayes) Check(s *Submission) error {
+	c := cachedClassifier()
+	if !c.Ready() {
+		return nil
+	}
+	if c.SpamProbability(s.Text()) >= b.Threshold {
+		return errLooksLikeSpam
+	}
+	return nil
+}
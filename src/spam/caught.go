@@ -0,0 +1,107 @@
+package spam
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CaughtDBName is the path to the log of submissions the filters turned away.
+const CaughtDBName = "spam/caught"
+
+// MaxCaught is how many caught submissions are kept for review, newest first.
+const MaxCaught = 100
+
+// Caught is a submission that one of the filters turned away.
+type Caught struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Body      string    `json:"body"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Filter    string    `json:"filter"` // name of the filter that caught it
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"`
+}
+
+// Submission returns what was submitted, for training the classifier.
+func (c *Caught) Submission() *Submission {
+	return &Submission{
+		Kind:      c.Kind,
+		Name:      c.Name,
+		Email:     c.Email,
+		Body:      c.Body,
+		IP:        c.IP,
+		UserAgent: c.UserAgent,
+		Time:      c.Time,
+	}
+}
+
+// CaughtLog is the list of recently caught submissions.
+type CaughtLog struct {
+	Items []*Caught `json:"items"`
+}
+
+// LoadCaught loads the log of caught submissions.
+func LoadCaught() *CaughtLog {
+	l := &CaughtLog{
+		Items: []*Caught{},
+	}
+	if DB != nil {
+		DB.Get(CaughtDBName, &l)
+	}
+	return l
+}
+
+// Catch adds a rejected submission to the log, dropping the oldest ones past
+// MaxCaught.
+func Catch(s *Submission, r *Rejection) error {
+	if DB == nil {
+		return nil
+	}
+
+	l := &CaughtLog{}
+	return DB.Update(CaughtDBName, l, func() error {
+		l.Items = append([]*Caught{{
+			ID:        uuid.New().String(),
+			Kind:      s.Kind,
+			Name:      s.Name,
+			Email:     s.Email,
+			Body:      s.Body,
+			IP:        s.IP,
+			UserAgent: s.UserAgent,
+			Filter:    r.Filter,
+			Reason:    r.Error(),
+			Time:      s.Time,
+		}}, l.Items...)
+		if len(l.Items) > MaxCaught {
+			l.Items = l.Items[:MaxCaught]
+		}
+		return nil
+	})
+}
+
+// Remove a caught submission from the log once it's been reviewed, returning
+// it.
+func (l *CaughtLog) Remove(id string) (*Caught, error) {
+	var removed *Caught
+	err := DB.Update(CaughtDBName, l, func() error {
+		keep := []*Caught{}
+		for _, c := range l.Items {
+			if c.ID == id {
+				removed = c
+			} else {
+				keep = append(keep, c)
+			}
+		}
+		if removed == nil {
+			return errors.New("that submission is no longer in the log")
+		}
+		l.Items = keep
+		return nil
+	})
+	return removed, err
+}
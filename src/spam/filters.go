@@ -0,0 +1,166 @@
+package spam
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var reLink = regexp.MustCompile(`(?i)(https?://|www\.)`)
+
+// LinkLimit rejects submissions with more than this many links.
+type LinkLimit int
+
+// Name of the filter.
+func (l LinkLimit) Name() string {
+	return "link limit"
+}
+
+// Check the number of links.
+func (l LinkLimit) Check(s *Submission) error {
+	if n := len(reLink.FindAllString(s.Body, -1)); n > int(l) {
+		return fmt.Errorf("your message has too many links (the limit is %d)", l)
+	}
+	return nil
+}
+
+// Blocklist rejects submissions containing any of its words or phrases, or
+// matching any of its regular expressions.
+type Blocklist struct {
+	words    []string
+	patterns []*regexp.Regexp
+}
+
+// NewBlocklist reads a list of blocked words and phrases. An entry written
+// between slashes, like `/viagra|cialis/`, is a regular expression. Both are
+// matched without regard to case.
+func NewBlocklist(entries []string) (*Blocklist, error) {
+	b := &Blocklist{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			re, err := regexp.Compile("(?i)" + entry[1:len(entry)-1])
+			if err != nil {
+				return b, fmt.Errorf("blocklist entry %s: %s", entry, err)
+			}
+			b.patterns = append(b.patterns, re)
+			continue
+		}
+		b.words = append(b.words, strings.ToLower(entry))
+	}
+	return b, nil
+}
+
+// Name of the filter.
+func (b *Blocklist) Name() string {
+	return "blocklist"
+}
+
+// Check the submission's name, email and message against the blocklist.
+func (b *Blocklist) Check(s *Submission) error {
+	text := s.Text()
+	lower := strings.ToLower(text)
+	for _, word := range b.words {
+		if strings.Contains(lower, word) {
+			return errLooksLikeSpam
+		}
+	}
+	for _, re := range b.patterns {
+		if re.MatchString(text) {
+			return errLooksLikeSpam
+		}
+	}
+	return nil
+}
+
+var errLooksLikeSpam = errors.New("your message can't be sent because it looks like spam")
+
+// RateLimit rejects submissions from somebody who has already sent too many
+// recently, going by their IP address or email address. The counts are kept
+// in memory, and are shared by all the forms.
+type RateLimit struct {
+	Key    string // "ip" or "email"
+	Max    int
+	Window time.Duration
+}
+
+// recent holds the times of the recent submissions by each IP or email, and
+// when each kind of rate limit last swept out the ones that aged out.
+var recent = struct {
+	sync.Mutex
+	times map[string][]time.Time
+	swept map[string]time.Time
+}{
+	times: map[string][]time.Time{},
+	swept: map[string]time.Time{},
+}
+
+// sweepEvery is how often a rate limit forgets everybody whose submissions
+// have all aged out of its window, so that the counts don't grow forever.
+const sweepEvery = time.Minute
+
+// Name of the filter.
+func (l RateLimit) Name() string {
+	return "rate limit by " + l.Key
+}
+
+// Check and count the submission against the rate limit. Edits aren't
+// counted; only the first time something was sent is.
+func (l RateLimit) Check(s *Submission) error {
+	if s.Edit {
+		return nil
+	}
+
+	var key string
+	switch l.Key {
+	case "ip":
+		key = s.IP
+	case "email":
+		key = strings.ToLower(s.Email)
+	}
+	if key == "" {
+		return nil
+	}
+	key = l.Key + ":" + key
+
+	recent.Lock()
+	defer recent.Unlock()
+
+	// Forget the submissions that have aged out of the window.
+	cutoff := s.Time.Add(-l.Window)
+	if s.Time.Sub(recent.swept[l.Key]) >= sweepEvery {
+		l.sweep(cutoff)
+		recent.swept[l.Key] = s.Time
+	}
+	keep := []time.Time{}
+	for _, t := range recent.times[key] {
+		if t.After(cutoff) {
+			keep = append(keep, t)
+		}
+	}
+
+	if len(keep) >= l.Max {
+		recent.times[key] = keep
+		return errors.New("you're sending messages too quickly; please try again later")
+	}
+	recent.times[key] = append(keep, s.Time)
+	return nil
+}
+
+// sweep forgets the IPs or emails whose latest submission under this rate
+// limit was before the cutoff. The caller must hold the lock on recent.
+func (l RateLimit) sweep(cutoff time.Time) {
+	prefix := l.Key + ":"
+	for key, times := range recent.times {
+		if strings.HasPrefix(key, prefix) && (len(times) == 0 || !times[len(times)-1].After(cutoff)) {
+			delete(recent.times, key)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package spam checks what visitors submit through the public forms (comments,
+// the contact form and questions) against a pipeline of spam filters.
+package spam
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/models/comments"
+	"github.com/kirsle/blog/models/settings"
+	"github.com/kirsle/blog/src/log"
+	"github.com/kirsle/blog/src/middleware"
+)
+
+// DB is a reference to the parent app's JsonDB object, which holds the
+// classifier's training and the log of caught submissions.
+var DB *jsondb.DB
+
+// Kinds of submission.
+const (
+	Comment  = "comment"
+	Contact  = "contact"
+	Question = "question"
+)
+
+// Submission is something a visitor sent through one of the public forms.
+type Submission struct {
+	Kind      string // Comment, Contact or Question
+	Name      string
+	Email     string
+	Body      string
+	IP        string
+	UserAgent string
+	Time      time.Time
+	Edit      bool // a change to something sent before, i.e. a comment
+}
+
+// NewSubmission prepares a submission from a request.
+func NewSubmission(r *http.Request, kind, name, email, body string) *Submission {
+	return &Submission{
+		Kind:      kind,
+		Name:      name,
+		Email:     email,
+		Body:      body,
+		IP:        middleware.RemoteAddr(r),
+		UserAgent: r.UserAgent(),
+		Time:      time.Now().UTC(),
+	}
+}
+
+// Text returns all the text of the submission that filters look at.
+func (s *Submission) Text() string {
+	return s.Name + "\n" + s.Email + "\n" + s.Body
+}
+
+// Filter is a spam check. Check returns an error, worded for the visitor, if
+// the submission should be turned away.
+type Filter interface {
+	Name() string
+	Check(s *Submission) error
+}
+
+// Rejection is the error from a Pipeline, saying which filter caught the
+// submission.
+type Rejection struct {
+	Filter string
+	Err    error
+}
+
+func (r *Rejection) Error() string {
+	return r.Err.Error()
+}
+
+// Pipeline runs a submission through each of its filters in turn.
+type Pipeline []Filter
+
+// Check the submission against each filter, stopping at the first one that
+// rejects it.
+func (p Pipeline) Check(s *Submission) error {
+	for _, f := range p {
+		if err := f.Check(s); err != nil {
+			return &Rejection{
+				Filter: f.Name(),
+				Err:    err,
+			}
+		}
+	}
+	return nil
+}
+
+// Default returns the pipeline configured in the site settings. The cheap
+// filters run first, and the rate limits come last so that a submission is
+// only counted against them if nothing else turned it away.
+func Default(s *settings.Settings) Pipeline {
+	p := Pipeline{}
+	if s.Spam.MaxLinks > 0 {
+		p = append(p, LinkLimit(s.Spam.MaxLinks))
+	}
+	if len(s.Spam.Blocklist) > 0 {
+		blocklist, err := NewBlocklist(s.Spam.Blocklist)
+		if err != nil {
+			// Settings are validated when saved, so this shouldn't happen.
+			log.Error("Bad spam blocklist in the settings: %s", err)
+		}
+		p = append(p, blocklist)
+	}
+	if s.Spam.Classifier {
+		p = append(p, Bayes{Threshold: DefaultThreshold})
+	}
+	if s.Spam.IPRate > 0 {
+		p = append(p, RateLimit{
+			Key:    "ip",
+			Max:    s.Spam.IPRate,
+			Window: time.Hour,
+		})
+	}
+	if s.Spam.EmailRate > 0 {
+		p = append(p, RateLimit{
+			Key:    "email",
+			Max:    s.Spam.EmailRate,
+			Window: time.Hour,
+		})
+	}
+	return p
+}
+
+// Check a submission against the site's spam filters. A submission that gets
+// caught is kept in the log for the admin to review.
+func Check(s *Submission) error {
+	config, err := settings.Load()
+	if err != nil {
+		config = settings.Defaults()
+	}
+
+	err = Default(config).Check(s)
+	if rejection, ok := err.(*Rejection); ok {
+		if err := Catch(s, rejection); err != nil {
+			log.Error("Couldn't log the caught %s: %s", s.Kind, err)
+		}
+	}
+	return err
+}
+
+// ErrBanned is the error for a submission from a banned email or IP address.
+var ErrBanned = errors.New("you aren't allowed to post here")
+
+// Screen checks a submission against the ban list, then the spam filters.
+//
+// A banned sender is turned away with ErrBanned, unless the ban list is set to
+// hold their posts: then `held` is true, and the post should be accepted
+// without a fuss but kept out of sight until a moderator looks at it.
+func Screen(s *Submission) (held bool, err error) {
+	b := comments.LoadBanList()
+	if b.Blocks(s.Email, s.IP) {
+		if b.Hold {
+			return true, nil
+		}
+		return false, ErrBanned
+	}
+	return false, Check(s)
+}
@@ -0,0 +1,133 @@
+package spam_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kirsle/blog/jsondb"
+	"github.com/kirsle/blog/src/spam"
+)
+
+func TestFilters(t *testing.T) {
+	blocklist, err := spam.NewBlocklist([]string{"Cheap Pills", "/casino|lottery/", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := spam.NewBlocklist([]string{"/(/"}); err == nil {
+		t.Error("expected an error for a bad regexp")
+	}
+
+	var tests = []struct {
+		name   string
+		filter spam.Filter
+		body   string
+		expect bool // whether it's rejected
+	}{
+		{"under the link limit", spam.LinkLimit(2), "see https://example.com and www.example.org", false},
+		{"over the link limit", spam.LinkLimit(2), "http://a.com http://b.com https://c.com", true},
+		{"clean message", blocklist, "Nice post!", false},
+		{"blocked phrase", blocklist, "buy CHEAP pills here", true},
+		{"blocked regexp", blocklist, "Online Casino bonus", true},
+	}
+	for _, test := range tests {
+		err := test.filter.Check(&spam.Submission{Body: test.body})
+		if (err != nil) != test.expect {
+			t.Errorf("%s: expected rejected=%v, got %v", test.name, test.expect, err)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Now()
+	p := spam.Pipeline{
+		spam.RateLimit{Key: "email", Max: 2, Window: time.Hour},
+	}
+
+	for i, expect := range []bool{false, false, true} {
+		s := &spam.Submission{Email: "Rate@example.com", Time: now.Add(time.Duration(i) * time.Minute)}
+		err := p.Check(s)
+		if (err != nil) != expect {
+			t.Errorf("submission %d: expected rejected=%v, got %v", i, expect, err)
+		}
+		if err != nil && err.(*spam.Rejection).Filter != "rate limit by email" {
+			t.Errorf("unexpected filter name: %s", err.(*spam.Rejection).Filter)
+		}
+	}
+
+	// Edits of what they sent before aren't counted.
+	s := &spam.Submission{Email: "rate@example.com", Time: now.Add(3 * time.Minute), Edit: true}
+	if err := p.Check(s); err != nil {
+		t.Errorf("expected an edit to pass the rate limit: %s", err)
+	}
+
+	// An hour later, they can post again.
+	s = &spam.Submission{Email: "rate@example.com", Time: now.Add(time.Hour + time.Minute)}
+	if err := p.Check(s); err != nil {
+		t.Errorf("expected the rate limit to have expired: %s", err)
+	}
+}
+
+func TestClassifier(t *testing.T) {
+	root, err := ioutil.TempDir("", "spam-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	spam.DB = jsondb.New(root)
+	defer func() { spam.DB = nil }()
+
+	filter := spam.Bayes{Threshold: spam.DefaultThreshold}
+	pitch := &spam.Submission{Body: "Win free money at our online casino, claim your prize now"}
+
+	hams := []string{
+		"Thanks for the write-up, the part about goroutines helped me a lot.",
+		"I had the same problem with my Raspberry Pi, updating the kernel fixed it.",
+		"Great photos from the trip! Where was the second one taken?",
+		"Could you share the config file you used for the web server?",
+		"I disagree about the editor, but the rest of the post is spot on.",
+	}
+	spams := []string{
+		"Win free money now! Claim your prize at our casino.",
+		"Cheap replica watches, free shipping, claim your discount now.",
+		"Online casino bonus: win money free, no deposit needed.",
+		"Make money fast from home, claim your free prize today.",
+		"Free casino spins, win big money, click now to claim.",
+	}
+	for i := range hams {
+		if err := spam.Train(&spam.Submission{Body: hams[i]}, false); err != nil {
+			t.Fatalf("Train: %s", err)
+		}
+
+		// It doesn't reject anything until it's had enough training.
+		if err := filter.Check(pitch); err != nil {
+			t.Fatalf("rejected before it was trained: %s", err)
+		}
+		spam.Train(&spam.Submission{Body: spams[i]}, true)
+	}
+
+	c := spam.LoadClassifier()
+	if !c.Ready() || c.SpamDocs != 5 || c.HamDocs != 5 {
+		t.Fatalf("unexpected training counts: %d spam, %d ham", c.SpamDocs, c.HamDocs)
+	}
+	if err := filter.Check(pitch); err == nil {
+		t.Error("expected the sales pitch to be rejected")
+	}
+	if err := filter.Check(&spam.Submission{Body: "Thanks, the kernel update fixed my Raspberry Pi too."}); err != nil {
+		t.Errorf("expected a real comment to be accepted: %s", err)
+	}
+
+	// Caught submissions are logged for review.
+	rejection := &spam.Rejection{Filter: filter.Name(), Err: filter.Check(pitch)}
+	if err := spam.Catch(pitch, rejection); err != nil {
+		t.Fatalf("Catch: %s", err)
+	}
+	log := spam.LoadCaught()
+	if len(log.Items) != 1 || log.Items[0].Filter != "classifier" || log.Items[0].Body != pitch.Body {
+		t.Fatalf("unexpected caught log: %+v", log.Items)
+	}
+	if _, err := log.Remove(log.Items[0].ID); err != nil || len(spam.LoadCaught().Items) != 0 {
+		t.Errorf("Remove: %v", err)
+	}
+}
@@ -8,10 +8,11 @@ type ContentType string
 
 // Post privacy constants.
 const (
-	PUBLIC   PostPrivacy = "public"
-	PRIVATE              = "private"
-	UNLISTED             = "unlisted"
-	DRAFT                = "draft"
+	PUBLIC    PostPrivacy = "public"
+	PRIVATE               = "private"
+	UNLISTED              = "unlisted"
+	DRAFT                 = "draft"
+	SCHEDULED             = "scheduled" // a draft until its PublishAt time
 )
 
 // Content types for blog posts.